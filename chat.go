@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/hajimehoshi/ebiten/text"
+	"github.com/zucenko/roaderclient/client"
+	"golang.org/x/image/font"
+	"image/color"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	chatVisible = 5 * time.Second
+	chatFade    = 2 * time.Second
+	chatLines   = 6
+	chatScale   = .3
+	// chatLineHeight is Font line height before chatScale
+	chatLineHeight = 60
+)
+
+// ChatInput is the chat box ACTION_CHAT opens over the board
+type ChatInput struct {
+	Open bool
+	Text string
+	// Err is why the last message was not sent
+	Err string
+
+	images    map[client.ChatLine]*ebiten.Image
+	input     *ebiten.Image
+	inputText string
+}
+
+// updateChat returns true while the chat box takes the keyboard
+func (play *Play) updateChat() bool {
+	chat := &play.Chat
+	if chat.Open && inpututil.IsKeyJustPressed(ebiten.KeyEnter) || !chat.Open && play.Keymap.Pressed(ACTION_CHAT) {
+		if chat.Open {
+			chat.Err = ""
+			if err := play.GameSession.Say(chat.Text); err != nil {
+				chat.Err = err.Error()
+			}
+			chat.Text = ""
+		}
+		chat.Open = !chat.Open
+		return true
+	}
+	if !chat.Open {
+		return false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		chat.Open, chat.Text = false, ""
+		return true
+	}
+	for _, r := range ebiten.InputChars() {
+		if len(chat.Text)+utf8.RuneLen(r) <= client.MaxChatText {
+			chat.Text += string(r)
+		}
+	}
+	if repeatingKeyPressed(ebiten.KeyBackspace) && len(chat.Text) > 0 {
+		_, size := utf8.DecodeLastRuneInString(chat.Text)
+		chat.Text = chat.Text[:len(chat.Text)-size]
+	}
+	return true
+}
+
+// drawChat shows the last chat lines fading out, all of them while typing
+func (play *Play) drawChat(screen *ebiten.Image) {
+	chat := &play.Chat
+	lines := play.GameSession.Chat.Lines()
+	if len(lines) > chatLines {
+		lines = lines[len(lines)-chatLines:]
+	}
+	if chat.images == nil {
+		chat.images = make(map[client.ChatLine]*ebiten.Image)
+	}
+	shown := make(map[client.ChatLine]*ebiten.Image, len(lines))
+
+	y := float64(screenHeight) - 30
+	if chat.Open {
+		status := "> " + chat.Text + "_"
+		if chat.Text == "" && chat.Err != "" {
+			status = "> " + chat.Err
+		}
+		if chat.input == nil || chat.inputText != status {
+			chat.input = chatImage(status, color.White)
+			chat.inputText = status
+		}
+		drawChatImage(screen, chat.input, y, 1)
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		y -= chatLineHeight * chatScale
+		alpha := 1.0
+		if age := time.Since(line.At); !chat.Open && age > chatVisible {
+			alpha = 1 - float64(age-chatVisible)/float64(chatFade)
+		}
+		if alpha <= 0 {
+			break
+		}
+		img := chat.images[line]
+		if img == nil {
+			img = chatImage(play.chatText(line.ChatMessage), chatColor(line.From))
+		}
+		shown[line] = img
+		drawChatImage(screen, img, y, alpha)
+	}
+	// faded lines drop their images
+	chat.images = shown
+}
+
+func (play *Play) chatText(m client.ChatMessage) string {
+	if m.From == 0 {
+		return "spectator: " + m.Text
+	}
+	return play.GameSession.Name(m.From) + ": " + m.Text
+}
+
+func chatColor(from int32) color.Color {
+	if from == 0 {
+		return color.White
+	}
+	c := colorForPlayer(from)
+	return color.RGBA{uint8(c.r * 255), uint8(c.g * 255), uint8(c.b * 255), 0xff}
+}
+
+func chatImage(s string, clr color.Color) *ebiten.Image {
+	width := font.MeasureString(Font, s).Ceil() + 20
+	image, _ := ebiten.NewImage(width, chatLineHeight, ebiten.FilterLinear)
+	image.Fill(color.RGBA{0, 0, 0, 105})
+	text.Draw(image, s, Font, 10, 48, clr)
+	return image
+}
+
+func drawChatImage(screen, img *ebiten.Image, y float64, alpha float64) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(chatScale, chatScale)
+	op.GeoM.Translate(10, y)
+	op.ColorM.Scale(1, 1, 1, alpha)
+	screen.DrawImage(img, op)
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between reconnect attempts.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	// Jitter is the fraction of the delay randomized, 0 disables it
+	Jitter  float64
+	attempt int
+}
+
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Min:    250 * time.Millisecond,
+		Max:    10 * time.Second,
+		Factor: 2,
+		Jitter: .2,
+	}
+}
+
+// Next returns delay before the next attempt and advances the attempt counter.
+func (b *Backoff) Next() time.Duration {
+	d := float64(b.Min)
+	for i := 0; i < b.attempt; i++ {
+		d *= b.Factor
+		if d >= float64(b.Max) {
+			d = float64(b.Max)
+			break
+		}
+	}
+	b.attempt++
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (rand.Float64()*2 - 1)
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	return time.Duration(d)
+}
+
+func (b *Backoff) Attempt() int {
+	return b.attempt
+}
+
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxChatText is the longest chat message in bytes, longer ones are cut
+const MaxChatText = 200
+
+const chatLogSize = 50
+
+var ErrChatUnsupported = errors.New("server does not support chat")
+
+// ChatLine is received chat message and when it arrived
+type ChatLine struct {
+	ChatMessage
+	At time.Time
+}
+
+// ChatLog keeps the last Max chat messages, safe for concurrent use
+type ChatLog struct {
+	Max   int
+	mu    sync.Mutex
+	lines []ChatLine
+}
+
+func NewChatLog(max int) *ChatLog {
+	return &ChatLog{Max: max}
+}
+
+func (l *ChatLog) Add(m ChatMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, ChatLine{ChatMessage: m, At: time.Now()})
+	if over := len(l.lines) - l.Max; l.Max > 0 && over > 0 {
+		l.lines = append(l.lines[:0:0], l.lines[over:]...)
+	}
+}
+
+// Lines returns copy of the log, oldest first
+func (l *ChatLog) Lines() []ChatLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ChatLine(nil), l.lines...)
+}
+
+func (l *ChatLog) Reset() {
+	l.mu.Lock()
+	l.lines = nil
+	l.mu.Unlock()
+}
+
+// Supports tells whether the server announced extension in its last Setup
+func (gs *GameSession) Supports(extension string) bool {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, e := range gs.extensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// Say queues chat message, it shows in Chat once the server relays it back
+func (gs *GameSession) Say(text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if !gs.Supports(EXT_CHAT) {
+		return ErrChatUnsupported
+	}
+	if len(text) > MaxChatText {
+		text = strings.ToValidUTF8(text[:MaxChatText], "")
+	}
+	select {
+	case gs.ChatOut <- ChatMessage{From: gs.PlayerKey, Text: text}:
+		return nil
+	default:
+		return errors.New("chat: too many messages waiting")
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"sort"
+)
+
+// Codec encodes model.ClientMessage / model.ServerMessage into websocket frames,
+// one message per frame. It is chosen by Config.Codec at connect time and
+// offered to the server as websocket subprotocol "roader.<name>".
+type Codec interface {
+	Name() string
+	// MessageType is websocket frame type messages are written as
+	MessageType() int
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+var Codecs = map[string]Codec{
+	"gob":    GobCodec{},
+	"json":   JSONCodec{},
+	"binary": BinaryCodec{},
+}
+
+func CodecByName(name string) (Codec, error) {
+	c, found := Codecs[name]
+	if !found {
+		names := make([]string, 0, len(Codecs))
+		for n := range Codecs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown codec %q, use one of %v", name, names)
+	}
+	return c, nil
+}
+
+// StreamCodec keeps coder state for the whole connection, so gob type
+// descriptors are sent once instead of in every frame. It is used only when
+// the server accepts StreamSubprotocol, plain per frame Codec is the fallback
+// for servers which do not negotiate.
+type StreamCodec interface {
+	Codec
+	StreamSubprotocol() string
+	// NewStream returns coder for one connection, Encode and Decode may be
+	// called from different goroutines but each from only one
+	NewStream() Codec
+}
+
+func Subprotocol(c Codec) string {
+	return "roader." + c.Name()
+}
+
+// Subprotocols offered when dialing, most preferred first
+func Subprotocols(c Codec) []string {
+	if sc, ok := c.(StreamCodec); ok {
+		return []string{sc.StreamSubprotocol(), Subprotocol(c)}
+	}
+	return []string{Subprotocol(c)}
+}
+
+// Negotiated picks coder for connection which agreed on subprotocol
+func Negotiated(c Codec, subprotocol string) Codec {
+	if sc, ok := c.(StreamCodec); ok && subprotocol == sc.StreamSubprotocol() {
+		return sc.NewStream()
+	}
+	return c
+}
+
+// GobCodec is what the roader server speaks, new gob stream in every frame
+type GobCodec struct{}
+
+func (GobCodec) Name() string              { return "gob" }
+func (GobCodec) MessageType() int          { return websocket.BinaryMessage }
+func (GobCodec) StreamSubprotocol() string { return "roader.gob-stream" }
+
+func (GobCodec) Encode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func (GobCodec) Decode(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+func (GobCodec) NewStream() Codec {
+	s := &gobStream{}
+	s.enc = gob.NewEncoder(&s.out)
+	s.dec = gob.NewDecoder(&s.in)
+	return s
+}
+
+// gobStream is one gob stream spanning all frames of connection, each frame
+// carries exactly one message preceded by type descriptors not sent yet
+type gobStream struct {
+	GobCodec
+	out bytes.Buffer
+	enc *gob.Encoder
+	// in implements io.ByteReader so decoder never reads past current frame
+	in  bytes.Buffer
+	dec *gob.Decoder
+}
+
+func (s *gobStream) Encode(w io.Writer, v interface{}) error {
+	s.out.Reset()
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(s.out.Bytes())
+	return err
+}
+
+func (s *gobStream) Decode(r io.Reader, v interface{}) error {
+	if _, err := s.in.ReadFrom(r); err != nil {
+		return err
+	}
+	return s.dec.Decode(v)
+}
+
+// JSONCodec sends text frames readable in browser devtools
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string     { return "json" }
+func (JSONCodec) MessageType() int { return websocket.TextMessage }
+
+func (JSONCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
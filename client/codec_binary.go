@@ -0,0 +1,405 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/zucenko/roader/model"
+	"io"
+	"sort"
+)
+
+const maxBinaryMessage = 1 << 20
+
+var errBinaryShort = errors.New("binary codec: message truncated")
+
+// BinaryCodec is compact hand written encoding of the model messages.
+// Message is uvarint length followed by payload of varints and bool bytes,
+// fields in declaration order, slices and maps prefixed by their length.
+// Frames append their extension fields after the model message, the section
+// is present only when some extension field is set.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Name() string     { return "binary" }
+func (BinaryCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (BinaryCodec) Encode(w io.Writer, v interface{}) error {
+	b := &binWriter{}
+	switch m := v.(type) {
+	case model.ClientMessage:
+		b.clientMessage(&m)
+	case *model.ClientMessage:
+		b.clientMessage(m)
+	case model.ServerMessage:
+		b.serverMessage(&m)
+	case *model.ServerMessage:
+		b.serverMessage(m)
+	case ClientFrame:
+		b.clientFrame(&m)
+	case *ClientFrame:
+		b.clientFrame(m)
+	case ServerFrame:
+		b.serverFrame(&m)
+	case *ServerFrame:
+		b.serverFrame(m)
+	default:
+		return fmt.Errorf("binary codec: cant encode %T", v)
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b.buf)))
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(b.buf)
+	return err
+}
+
+func (BinaryCodec) Decode(r io.Reader, v interface{}) error {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		buffered := bufio.NewReader(r)
+		br, r = buffered, buffered
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if size > maxBinaryMessage {
+		return fmt.Errorf("binary codec: message of %d bytes too big", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	b := &binReader{buf: buf}
+	switch m := v.(type) {
+	case *model.ClientMessage:
+		b.clientMessage(m)
+	case *model.ServerMessage:
+		b.serverMessage(m)
+	case *ClientFrame:
+		b.clientFrame(m)
+	case *ServerFrame:
+		b.serverFrame(m)
+	default:
+		return fmt.Errorf("binary codec: cant decode into %T", v)
+	}
+	if b.err == nil && len(b.buf) != 0 {
+		b.err = fmt.Errorf("binary codec: %d trailing bytes", len(b.buf))
+	}
+	return b.err
+}
+
+type binWriter struct {
+	buf []byte
+}
+
+func (b *binWriter) int(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	b.buf = append(b.buf, tmp[:n]...)
+}
+
+func (b *binWriter) len(n int) {
+	var tmp [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(tmp[:], uint64(n))
+	b.buf = append(b.buf, tmp[:l]...)
+}
+
+func (b *binWriter) bool(v bool) {
+	if v {
+		b.buf = append(b.buf, 1)
+	} else {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *binWriter) bools(v []bool) {
+	b.len(len(v))
+	for _, x := range v {
+		b.bool(x)
+	}
+}
+
+func (b *binWriter) clientMessage(m *model.ClientMessage) {
+	b.int(int64(m.Move))
+}
+
+func (b *binWriter) player(p model.Player) {
+	b.int(int64(p.Id))
+	b.int(int64(p.Keys))
+	b.int(int64(p.Diamonds))
+	b.int(int64(p.Col))
+	b.int(int64(p.Row))
+}
+
+func (b *binWriter) serverMessage(m *model.ServerMessage) {
+	b.len(len(m.Setup))
+	for _, s := range m.Setup {
+		b.int(int64(s.Cols))
+		b.int(int64(s.Rows))
+		b.int(int64(s.PlayerKey))
+		keys := make([]int, 0, len(s.Players))
+		for k := range s.Players {
+			keys = append(keys, int(k))
+		}
+		sort.Ints(keys)
+		b.len(len(keys))
+		for _, k := range keys {
+			b.int(int64(k))
+			b.player(s.Players[int32(k)])
+		}
+	}
+	b.len(len(m.Directions))
+	for _, d := range m.Directions {
+		b.int(int64(d.Direction))
+		b.int(int64(d.Col))
+		b.int(int64(d.Row))
+		b.bool(d.Success)
+		b.int(int64(d.PlayerKey))
+	}
+	b.len(len(m.Visibles))
+	for _, v := range m.Visibles {
+		b.int(int64(v.Col))
+		b.int(int64(v.Row))
+		b.bools(v.Walls)
+		b.bools(v.Locks)
+		b.bool(v.Diamond)
+		b.bool(v.Key)
+		b.bool(v.Portal)
+		b.int(int64(v.PortalToCol))
+		b.int(int64(v.PortalToRow))
+		b.bool(v.HasPlayer)
+		b.int(int64(v.PlayerId))
+	}
+	b.len(len(m.Picks))
+	for _, p := range m.Picks {
+		b.int(int64(p.Keys))
+		b.int(int64(p.Diamonds))
+	}
+}
+
+func (b *binWriter) string(v string) {
+	b.len(len(v))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *binWriter) chat(m ChatMessage) {
+	b.int(int64(m.From))
+	b.string(m.Text)
+}
+
+func (b *binWriter) clientFrame(f *ClientFrame) {
+	b.clientMessage(&model.ClientMessage{Move: f.Move})
+	if f.Chat == nil {
+		return
+	}
+	b.bool(true)
+	b.chat(*f.Chat)
+}
+
+func (b *binWriter) serverFrame(f *ServerFrame) {
+	sm := f.Message()
+	b.serverMessage(&sm)
+	if len(f.Extensions) == 0 && len(f.Chat) == 0 && len(f.Names) == 0 {
+		return
+	}
+	b.len(len(f.Extensions))
+	for _, e := range f.Extensions {
+		b.string(e)
+	}
+	b.len(len(f.Chat))
+	for _, c := range f.Chat {
+		b.chat(c)
+	}
+	keys := make([]int, 0, len(f.Names))
+	for k := range f.Names {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	b.len(len(keys))
+	for _, k := range keys {
+		b.int(int64(k))
+		b.string(f.Names[int32(k)])
+	}
+}
+
+// binReader keeps first error, later reads return zero values
+type binReader struct {
+	buf []byte
+	err error
+}
+
+func (b *binReader) int() int64 {
+	if b.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(b.buf)
+	if n <= 0 {
+		b.err = errBinaryShort
+		return 0
+	}
+	b.buf = b.buf[n:]
+	return v
+}
+
+func (b *binReader) len() int {
+	if b.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(b.buf)
+	// every element takes at least a byte, longer length is garbage
+	if n <= 0 || v > uint64(len(b.buf)) {
+		b.err = errBinaryShort
+		return 0
+	}
+	b.buf = b.buf[n:]
+	return int(v)
+}
+
+func (b *binReader) bool() bool {
+	if b.err != nil {
+		return false
+	}
+	if len(b.buf) == 0 {
+		b.err = errBinaryShort
+		return false
+	}
+	v := b.buf[0] != 0
+	b.buf = b.buf[1:]
+	return v
+}
+
+func (b *binReader) bools() []bool {
+	n := b.len()
+	if n == 0 {
+		return nil
+	}
+	v := make([]bool, n)
+	for i := range v {
+		v[i] = b.bool()
+	}
+	return v
+}
+
+func (b *binReader) clientMessage(m *model.ClientMessage) {
+	m.Move = int(b.int())
+}
+
+func (b *binReader) player() model.Player {
+	return model.Player{
+		Id:       int32(b.int()),
+		Keys:     int(b.int()),
+		Diamonds: int(b.int()),
+		Col:      int(b.int()),
+		Row:      int(b.int()),
+	}
+}
+
+func (b *binReader) serverMessage(m *model.ServerMessage) {
+	if n := b.len(); n > 0 {
+		m.Setup = make([]model.Setup, n)
+		for i := range m.Setup {
+			s := &m.Setup[i]
+			s.Cols = int(b.int())
+			s.Rows = int(b.int())
+			s.PlayerKey = int32(b.int())
+			players := b.len()
+			s.Players = make(map[int32]model.Player, players)
+			for j := 0; j < players; j++ {
+				k := int32(b.int())
+				s.Players[k] = b.player()
+			}
+		}
+	}
+	if n := b.len(); n > 0 {
+		m.Directions = make([]model.DirectionSuccess, n)
+		for i := range m.Directions {
+			d := &m.Directions[i]
+			d.Direction = int(b.int())
+			d.Col = int(b.int())
+			d.Row = int(b.int())
+			d.Success = b.bool()
+			d.PlayerKey = int32(b.int())
+		}
+	}
+	if n := b.len(); n > 0 {
+		m.Visibles = make([]model.Visibilize, n)
+		for i := range m.Visibles {
+			v := &m.Visibles[i]
+			v.Col = int(b.int())
+			v.Row = int(b.int())
+			v.Walls = b.bools()
+			v.Locks = b.bools()
+			v.Diamond = b.bool()
+			v.Key = b.bool()
+			v.Portal = b.bool()
+			v.PortalToCol = int(b.int())
+			v.PortalToRow = int(b.int())
+			v.HasPlayer = b.bool()
+			v.PlayerId = int32(b.int())
+		}
+	}
+	if n := b.len(); n > 0 {
+		m.Picks = make([]model.Pick, n)
+		for i := range m.Picks {
+			m.Picks[i].Keys = int(b.int())
+			m.Picks[i].Diamonds = int(b.int())
+		}
+	}
+}
+
+func (b *binReader) string() string {
+	n := b.len()
+	if b.err != nil {
+		return ""
+	}
+	v := string(b.buf[:n])
+	b.buf = b.buf[n:]
+	return v
+}
+
+func (b *binReader) chat() ChatMessage {
+	return ChatMessage{From: int32(b.int()), Text: b.string()}
+}
+
+func (b *binReader) clientFrame(f *ClientFrame) {
+	f.Move = int(b.int())
+	if b.err != nil || len(b.buf) == 0 {
+		return
+	}
+	if b.bool() {
+		c := b.chat()
+		f.Chat = &c
+	}
+}
+
+func (b *binReader) serverFrame(f *ServerFrame) {
+	sm := model.ServerMessage{}
+	b.serverMessage(&sm)
+	*f = Frame(sm)
+	if b.err != nil || len(b.buf) == 0 {
+		return
+	}
+	if n := b.len(); n > 0 {
+		f.Extensions = make([]string, n)
+		for i := range f.Extensions {
+			f.Extensions[i] = b.string()
+		}
+	}
+	if n := b.len(); n > 0 {
+		f.Chat = make([]ChatMessage, n)
+		for i := range f.Chat {
+			f.Chat[i] = b.chat()
+		}
+	}
+	if n := b.len(); n > 0 {
+		f.Names = make(map[int32]string, n)
+		for i := 0; i < n; i++ {
+			k := int32(b.int())
+			f.Names[k] = b.string()
+		}
+	}
+}
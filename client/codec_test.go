@@ -0,0 +1,120 @@
+package client
+
+import (
+	"bytes"
+	"github.com/zucenko/roader/model"
+	"reflect"
+	"testing"
+)
+
+// typical move reply, direction plus visible neighbourhood
+var benchServerMessage = model.ServerMessage{
+	Directions: []model.DirectionSuccess{{Direction: 0, Col: 4, Row: 7, Success: true, PlayerKey: 'A'}},
+	Visibles: []model.Visibilize{
+		{Col: 4, Row: 7, Walls: []bool{false, true, false, true}, Locks: []bool{false, false, false, false}},
+		{Col: 5, Row: 7, Walls: []bool{true, false, false, true}, Locks: []bool{true, false, false, false}, Key: true},
+		{Col: 4, Row: 8, Walls: []bool{false, false, true, false}, Locks: []bool{false, false, false, false}, Diamond: true},
+		{Col: 3, Row: 7, Walls: []bool{false, true, true, false}, Locks: []bool{false, false, false, false},
+			Portal: true, PortalToCol: 12, PortalToRow: 2},
+	},
+	Picks: []model.Pick{{Keys: 1, Diamonds: 3}},
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	setup := model.ServerMessage{Setup: []model.Setup{{
+		Cols: 20, Rows: 13, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 2}, 'B': {Id: 'B', Keys: 3}}}}}
+	coders := map[string]Codec{"gob-stream": GobCodec{}.NewStream()}
+	for name, c := range Codecs {
+		coders[name] = c
+	}
+	for name, c := range coders {
+		for _, sm := range []model.ServerMessage{setup, benchServerMessage, benchServerMessage} {
+			var buf bytes.Buffer
+			if err := c.Encode(&buf, sm); err != nil {
+				t.Fatalf("%s encode: %v", name, err)
+			}
+			var got model.ServerMessage
+			if err := c.Decode(&buf, &got); err != nil {
+				t.Fatalf("%s decode: %v", name, err)
+			}
+			if !reflect.DeepEqual(sm, got) {
+				t.Errorf("%s round trip\nwant %+v\ngot  %+v", name, sm, got)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%s left %d bytes of frame", name, buf.Len())
+			}
+		}
+	}
+}
+
+// frames must stay readable by peers which know only the model messages
+func TestFramesCompatible(t *testing.T) {
+	chat := ServerFrame{Chat: []ChatMessage{{From: 'B', Text: "hi ěšč"}}, Extensions: []string{EXT_CHAT},
+		Names: map[int32]string{'A': "Anna", 'B': "Bob"}}
+	for name, c := range Codecs {
+		var buf bytes.Buffer
+		c.Encode(&buf, benchServerMessage)
+		var f ServerFrame
+		if err := c.Decode(&buf, &f); err != nil || !reflect.DeepEqual(f, Frame(benchServerMessage)) {
+			t.Errorf("%s model message into frame %+v %v", name, f, err)
+		}
+
+		buf.Reset()
+		c.Encode(&buf, chat)
+		f = ServerFrame{}
+		if err := c.Decode(&buf, &f); err != nil || !reflect.DeepEqual(f, chat) {
+			t.Errorf("%s chat frame %+v %v", name, f, err)
+		}
+
+		buf.Reset()
+		c.Encode(&buf, ClientFrame{Move: 3})
+		var cm model.ClientMessage
+		if err := c.Decode(&buf, &cm); err != nil || cm.Move != 3 {
+			t.Errorf("%s client frame into model message %+v %v", name, cm, err)
+		}
+	}
+}
+
+func TestNegotiatedFallback(t *testing.T) {
+	if _, ok := Negotiated(GobCodec{}, "").(GobCodec); !ok {
+		t.Error("server without subprotocol must get per frame gob")
+	}
+	if _, ok := Negotiated(GobCodec{}, "roader.gob-stream").(*gobStream); !ok {
+		t.Error("accepted gob-stream must get gob stream")
+	}
+}
+
+func benchmarkCodec(b *testing.B, enc, dec Codec) {
+	var frame bytes.Buffer
+	var total int
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame.Reset()
+		if err := enc.Encode(&frame, benchServerMessage); err != nil {
+			b.Fatal(err)
+		}
+		total += frame.Len()
+		var sm model.ServerMessage
+		if err := dec.Decode(&frame, &sm); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(total)/float64(b.N), "B/msg")
+}
+
+func BenchmarkGobPerFrame(b *testing.B) {
+	benchmarkCodec(b, GobCodec{}, GobCodec{})
+}
+
+func BenchmarkGobStream(b *testing.B) {
+	benchmarkCodec(b, GobCodec{}.NewStream(), GobCodec{}.NewStream())
+}
+
+func BenchmarkJSON(b *testing.B) {
+	benchmarkCodec(b, JSONCodec{}, JSONCodec{})
+}
+
+func BenchmarkBinary(b *testing.B) {
+	benchmarkCodec(b, BinaryCodec{}, BinaryCodec{})
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+const DefaultConfigFile = "roader.json"
+
+const MaxNameLength = 16
+
+// Config says where and as whom the GameSession connects.
+// Values are resolved defaults < config file < ROADER_* env < command-line flags.
+type Config struct {
+	Scheme string `json:"scheme"`
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	// Player is the player key ("A", "B", ...) to ask the server for, empty lets server choose
+	Player string `json:"player"`
+	// Name is shown to other players instead of the player key
+	Name string `json:"name"`
+	// Token authenticates the player, sent as bearer Authorization header
+	Token string `json:"token"`
+	// Codec is wire format name from Codecs
+	Codec string `json:"codec"`
+	// TLS is used only with wss scheme
+	TLS TLSConfig `json:"tls"`
+	// Spectate joins read-only, no player is controlled
+	Spectate bool `json:"spectate"`
+	// Lobby opens room list before joining a game
+	Lobby     bool   `json:"lobby"`
+	LobbyPath string `json:"lobby_path"`
+	// Room is id of lobby room to join, Invite joins room by invite code
+	Room   string `json:"room"`
+	Invite string `json:"invite"`
+	// ReplayDir receives replay file of every session, empty disables recording
+	ReplayDir string `json:"replay_dir"`
+	// Predict moves own player before the server confirms the move
+	Predict bool `json:"predict"`
+}
+
+type TLSConfig struct {
+	// CAFile is PEM bundle of root CAs trusted instead of system ones
+	CAFile string `json:"ca_file"`
+	// CertFile and KeyFile are optional client certificate
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ServerName overrides SNI and name verified in server certificate
+	ServerName string `json:"server_name"`
+	// Insecure skips server certificate verification, local testing only
+	Insecure bool `json:"insecure"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Scheme:    "ws",
+		Host:      "i.glow.cz:8080",
+		Path:      "/play",
+		LobbyPath: "/lobby",
+		Codec:     "gob",
+		ReplayDir: "replays",
+		Predict:   true,
+	}
+}
+
+// LoadConfig resolves configuration from the config file, environment and args
+// (typically os.Args[1:]).
+func LoadConfig(args []string) (Config, error) {
+	cfg := DefaultConfig()
+
+	fs := flag.NewFlagSet("roader", flag.ContinueOnError)
+	file := fs.String("config", "", "config file (env ROADER_CONFIG, default "+DefaultConfigFile+")")
+	flags := Config{}
+	fs.StringVar(&flags.Scheme, "scheme", cfg.Scheme, "websocket scheme, ws or wss (env ROADER_SCHEME)")
+	fs.StringVar(&flags.Host, "host", cfg.Host, "server host:port (env ROADER_HOST)")
+	fs.StringVar(&flags.Path, "path", cfg.Path, "websocket endpoint path (env ROADER_PATH)")
+	fs.StringVar(&flags.Player, "player", cfg.Player, "player key to join as, e.g. A (env ROADER_PLAYER)")
+	fs.StringVar(&flags.Name, "name", "", "display name (env ROADER_NAME)")
+	fs.StringVar(&flags.Token, "token", "", "auth token (env ROADER_TOKEN)")
+	fs.StringVar(&flags.Codec, "codec", cfg.Codec, "wire format gob, json or binary (env ROADER_CODEC)")
+	fs.StringVar(&flags.TLS.CAFile, "tls-ca", "", "PEM file with trusted root CAs (env ROADER_TLS_CA)")
+	fs.StringVar(&flags.TLS.CertFile, "tls-cert", "", "client certificate PEM file (env ROADER_TLS_CERT)")
+	fs.StringVar(&flags.TLS.KeyFile, "tls-key", "", "client certificate key PEM file (env ROADER_TLS_KEY)")
+	fs.StringVar(&flags.TLS.ServerName, "tls-server-name", "", "server name for SNI and verification (env ROADER_TLS_SERVER_NAME)")
+	fs.BoolVar(&flags.TLS.Insecure, "tls-insecure", false, "skip server certificate verification (env ROADER_TLS_INSECURE)")
+	fs.BoolVar(&flags.Spectate, "spectate", false, "watch a game without playing (env ROADER_SPECTATE)")
+	fs.BoolVar(&flags.Lobby, "lobby", false, "pick or create room in lobby before playing (env ROADER_LOBBY)")
+	fs.StringVar(&flags.LobbyPath, "lobby-path", cfg.LobbyPath, "lobby websocket endpoint path (env ROADER_LOBBY_PATH)")
+	fs.StringVar(&flags.Room, "room", "", "lobby room id to join (env ROADER_ROOM)")
+	fs.StringVar(&flags.Invite, "invite", "", "invite code of room to join (env ROADER_INVITE)")
+	fs.StringVar(&flags.ReplayDir, "replay-dir", cfg.ReplayDir, "directory for session replays, empty disables (env ROADER_REPLAY_DIR)")
+	fs.BoolVar(&flags.Predict, "predict", cfg.Predict, "move own player before server confirms (env ROADER_PREDICT)")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	path, required := *file, true
+	if path == "" {
+		path, required = os.Getenv("ROADER_CONFIG"), true
+	}
+	if path == "" {
+		path, required = DefaultConfigFile, false
+	}
+	if err := cfg.readFile(path, required); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.readEnv(); err != nil {
+		return cfg, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "scheme":
+			cfg.Scheme = flags.Scheme
+		case "host":
+			cfg.Host = flags.Host
+		case "path":
+			cfg.Path = flags.Path
+		case "player":
+			cfg.Player = flags.Player
+		case "name":
+			cfg.Name = flags.Name
+		case "token":
+			cfg.Token = flags.Token
+		case "codec":
+			cfg.Codec = flags.Codec
+		case "tls-ca":
+			cfg.TLS.CAFile = flags.TLS.CAFile
+		case "tls-cert":
+			cfg.TLS.CertFile = flags.TLS.CertFile
+		case "tls-key":
+			cfg.TLS.KeyFile = flags.TLS.KeyFile
+		case "tls-server-name":
+			cfg.TLS.ServerName = flags.TLS.ServerName
+		case "tls-insecure":
+			cfg.TLS.Insecure = flags.TLS.Insecure
+		case "spectate":
+			cfg.Spectate = flags.Spectate
+		case "lobby":
+			cfg.Lobby = flags.Lobby
+		case "lobby-path":
+			cfg.LobbyPath = flags.LobbyPath
+		case "room":
+			cfg.Room = flags.Room
+		case "invite":
+			cfg.Invite = flags.Invite
+		case "replay-dir":
+			cfg.ReplayDir = flags.ReplayDir
+		case "predict":
+			cfg.Predict = flags.Predict
+		}
+	})
+
+	return cfg, cfg.Validate()
+}
+
+// readFile overlays values present in json file
+func (cfg *Config) readFile(path string, required bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) readEnv() error {
+	for env, value := range map[string]*string{
+		"ROADER_SCHEME":          &cfg.Scheme,
+		"ROADER_HOST":            &cfg.Host,
+		"ROADER_PATH":            &cfg.Path,
+		"ROADER_PLAYER":          &cfg.Player,
+		"ROADER_NAME":            &cfg.Name,
+		"ROADER_TOKEN":           &cfg.Token,
+		"ROADER_CODEC":           &cfg.Codec,
+		"ROADER_TLS_CA":          &cfg.TLS.CAFile,
+		"ROADER_TLS_CERT":        &cfg.TLS.CertFile,
+		"ROADER_TLS_KEY":         &cfg.TLS.KeyFile,
+		"ROADER_TLS_SERVER_NAME": &cfg.TLS.ServerName,
+		"ROADER_REPLAY_DIR":      &cfg.ReplayDir,
+		"ROADER_LOBBY_PATH":      &cfg.LobbyPath,
+		"ROADER_ROOM":            &cfg.Room,
+		"ROADER_INVITE":          &cfg.Invite,
+	} {
+		if v, found := os.LookupEnv(env); found {
+			*value = v
+		}
+	}
+	for env, value := range map[string]*bool{
+		"ROADER_TLS_INSECURE": &cfg.TLS.Insecure,
+		"ROADER_SPECTATE":     &cfg.Spectate,
+		"ROADER_LOBBY":        &cfg.Lobby,
+		"ROADER_PREDICT":      &cfg.Predict,
+	} {
+		if v, found := os.LookupEnv(env); found {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+			*value = b
+		}
+	}
+	return nil
+}
+
+func (cfg Config) Validate() error {
+	if cfg.Scheme != "ws" && cfg.Scheme != "wss" {
+		return fmt.Errorf("config: unsupported scheme %q", cfg.Scheme)
+	}
+	if cfg.Host == "" {
+		return fmt.Errorf("config: host not set")
+	}
+	if _, err := CodecByName(cfg.Codec); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return fmt.Errorf("config: tls cert and key must be set together")
+	}
+	if len(cfg.Player) > 1 {
+		return fmt.Errorf("config: player %q is not single letter key", cfg.Player)
+	}
+	if utf8.RuneCountInString(cfg.Name) > MaxNameLength {
+		return fmt.Errorf("config: name longer than %d letters", MaxNameLength)
+	}
+	if cfg.Room != "" && cfg.Invite != "" {
+		return fmt.Errorf("config: join either room or invite")
+	}
+	if cfg.Spectate && cfg.Player != "" {
+		return fmt.Errorf("config: spectator can't join as player %q", cfg.Player)
+	}
+	return nil
+}
+
+// PlayerKey is the requested player as model key, 0 when not set
+func (cfg Config) PlayerKey() int32 {
+	if cfg.Player == "" {
+		return 0
+	}
+	return int32(cfg.Player[0])
+}
+
+// Header carries the auth token of websocket handshake
+func (cfg Config) Header() http.Header {
+	header := http.Header{}
+	if cfg.Token != "" {
+		header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	return header
+}
+
+func (cfg Config) URL() url.URL {
+	return url.URL{Scheme: cfg.Scheme, Host: cfg.Host, Path: cfg.Path}
+}
+
+// ClientConfig builds tls.Config for the wss dialer
+func (t TLSConfig) ClientConfig() (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.Insecure,
+	}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls ca: %w", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls ca: no certificates in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls client cert: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
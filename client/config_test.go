@@ -0,0 +1,154 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roader-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// DefaultConfigFile is looked up in working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	other := filepath.Join(dir, "other.json")
+	if err := ioutil.WriteFile(other, []byte(`{"host": "other:1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := map[string]string{}
+	unsetEnv := func() {
+		for _, kv := range os.Environ() {
+			if strings.HasPrefix(kv, "ROADER_") {
+				name := strings.SplitN(kv, "=", 2)[0]
+				if _, found := saved[name]; !found {
+					saved[name] = os.Getenv(name)
+				}
+				os.Unsetenv(name)
+			}
+		}
+	}
+	defer func() {
+		unsetEnv()
+		for name, v := range saved {
+			os.Setenv(name, v)
+		}
+	}()
+
+	for _, c := range []struct {
+		name string
+		// file is content of DefaultConfigFile, empty means no file
+		file string
+		env  map[string]string
+		args []string
+		// want changes DefaultConfig to the expected result
+		want func(*Config)
+		err  string
+	}{
+		{name: "defaults"},
+		{
+			name: "file over defaults",
+			file: `{"host": "file:1", "codec": "json", "tls": {"server_name": "file"}}`,
+			want: func(c *Config) { c.Host, c.Codec, c.TLS.ServerName = "file:1", "json", "file" },
+		},
+		{
+			name: "env over file",
+			file: `{"host": "file:1", "codec": "json"}`,
+			env:  map[string]string{"ROADER_HOST": "env:1"},
+			want: func(c *Config) { c.Host, c.Codec = "env:1", "json" },
+		},
+		{
+			name: "flag over env",
+			file: `{"host": "file:1", "codec": "json"}`,
+			env:  map[string]string{"ROADER_HOST": "env:1", "ROADER_CODEC": "binary"},
+			args: []string{"-host", "flag:1"},
+			want: func(c *Config) { c.Host, c.Codec = "flag:1", "binary" },
+		},
+		{
+			name: "bools",
+			file: `{"predict": true, "lobby": true, "tls": {"insecure": true}}`,
+			env:  map[string]string{"ROADER_PREDICT": "false", "ROADER_LOBBY": "0"},
+			args: []string{"-tls-insecure=false", "-lobby"},
+			want: func(c *Config) { c.Predict, c.Lobby, c.TLS.Insecure = false, true, false },
+		},
+		{
+			name: "unset flag keeps env",
+			env:  map[string]string{"ROADER_PREDICT": "false"},
+			args: []string{"-name", "Bob"},
+			want: func(c *Config) { c.Predict, c.Name = false, "Bob" },
+		},
+		{
+			name: "config env",
+			file: `{"host": "file:1"}`,
+			env:  map[string]string{"ROADER_CONFIG": other},
+			want: func(c *Config) { c.Host = "other:1" },
+		},
+		{
+			name: "config flag over env",
+			env:  map[string]string{"ROADER_CONFIG": filepath.Join(dir, "missing.json")},
+			args: []string{"-config", other},
+			want: func(c *Config) { c.Host = "other:1" },
+		},
+		{
+			name: "missing config",
+			env:  map[string]string{"ROADER_CONFIG": filepath.Join(dir, "missing.json")},
+			err:  "config file",
+		},
+		{name: "broken file", file: `{"host": `, err: "config file roader.json"},
+		{name: "bad bool", env: map[string]string{"ROADER_SPECTATE": "maybe"}, err: "ROADER_SPECTATE"},
+		{name: "bad tls bool", env: map[string]string{"ROADER_TLS_INSECURE": "yes please"}, err: "ROADER_TLS_INSECURE"},
+		{name: "unknown flag", args: []string{"-colour"}, err: "colour"},
+		{name: "scheme", args: []string{"-scheme", "http"}, err: "unsupported scheme"},
+		{name: "host", file: `{"host": ""}`, err: "host not set"},
+		{name: "codec", env: map[string]string{"ROADER_CODEC": "xml"}, err: "unknown codec"},
+		{name: "cert without key", args: []string{"-tls-cert", "cert.pem"}, err: "cert and key"},
+		{name: "key without cert", env: map[string]string{"ROADER_TLS_KEY": "key.pem"}, err: "cert and key"},
+		{name: "player", args: []string{"-player", "AB"}, err: "single letter"},
+		{name: "name", args: []string{"-name", strings.Repeat("x", MaxNameLength+1)}, err: "name longer"},
+		{name: "room and invite", args: []string{"-room", "r1", "-invite", "abc"}, err: "either room or invite"},
+		{name: "spectating player", file: `{"player": "A"}`, args: []string{"-spectate"}, err: "spectator"},
+	} {
+		unsetEnv()
+		for name, v := range c.env {
+			os.Setenv(name, v)
+		}
+		os.Remove(DefaultConfigFile)
+		if c.file != "" {
+			if err := ioutil.WriteFile(DefaultConfigFile, []byte(c.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cfg, err := LoadConfig(c.args)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		want := DefaultConfig()
+		if c.want != nil {
+			c.want(&want)
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s: got %+v\nwant %+v", c.name, cfg, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ErrorKind int
+
+const (
+	ERR_DIAL ErrorKind = iota + 1
+	ERR_READ
+	ERR_DECODE
+	ERR_WRITE
+	ERR_ENCODE
+	// ERR_CLOSED server closed the websocket with close frame
+	ERR_CLOSED
+	// ERR_TIMEOUT server did not answer heartbeat ping in time
+	ERR_TIMEOUT
+	// ERR_OVERFLOW inbound queue limits exceeded, session resyncs
+	ERR_OVERFLOW
+	// ERR_REJECTED server refused the session on purpose, bad token, unknown
+	// room or player taken; reconnecting would not help, the session ends.
+	// Refused resume of assigned player is ERR_CLOSED, the server may still
+	// hold the dropped connection.
+	ERR_REJECTED
+)
+
+func (k ErrorKind) Name() string {
+	switch k {
+	case ERR_DIAL:
+		return "DIAL"
+	case ERR_READ:
+		return "READ"
+	case ERR_DECODE:
+		return "DECODE"
+	case ERR_WRITE:
+		return "WRITE"
+	case ERR_ENCODE:
+		return "ENCODE"
+	case ERR_CLOSED:
+		return "CLOSED"
+	case ERR_TIMEOUT:
+		return "TIMEOUT"
+	case ERR_OVERFLOW:
+		return "OVERFLOW"
+	case ERR_REJECTED:
+		return "REJECTED"
+	default:
+		return fmt.Sprintf("N/A(%d)", k)
+	}
+}
+
+// SessionError is every error reported by GameSession, Kind tells which
+// stage of the connection failed, Err is the underlying cause.
+type SessionError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind.Name(), e.Err)
+}
+
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind ErrorKind, err error) *SessionError {
+	return &SessionError{Kind: kind, Err: err}
+}
+
+// ErrorKindOf is Kind of SessionError in err chain, 0 when there is none
+func ErrorKindOf(err error) ErrorKind {
+	var se *SessionError
+	if errors.As(err, &se) {
+		return se.Kind
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+)
+
+// Extensions a server may announce with Setup, the client uses an extension
+// only when the server announced it
+const (
+	EXT_CHAT  = "chat"
+	EXT_NAMES = "names"
+)
+
+// NoMove is Move of ClientFrame which carries only extension payload
+const NoMove = -1
+
+type ChatMessage struct {
+	// From is key of player who wrote it, 0 for spectator
+	From int32
+	Text string
+}
+
+// ClientFrame is model.ClientMessage with client extensions. Fields shared
+// with the model keep their names, so gob and json servers decoding plain
+// model.ClientMessage read it fine. Frames with NoMove are sent only to
+// servers announcing the extension.
+type ClientFrame struct {
+	Move int
+	Chat *ChatMessage
+}
+
+// ServerFrame is model.ServerMessage with server extensions, what the
+// session decodes every incoming frame into
+type ServerFrame struct {
+	Setup      []model.Setup
+	Directions []model.DirectionSuccess
+	Visibles   []model.Visibilize
+	Picks      []model.Pick
+	// Extensions the server supports, sent along with Setup
+	Extensions []string
+	Chat       []ChatMessage
+	// Names are display names of players, sent with Setup and when they change
+	Names map[int32]string
+}
+
+func Frame(sm model.ServerMessage) ServerFrame {
+	return ServerFrame{
+		Setup:      sm.Setup,
+		Directions: sm.Directions,
+		Visibles:   sm.Visibles,
+		Picks:      sm.Picks,
+	}
+}
+
+// Message is the part of frame applied to Model
+func (f ServerFrame) Message() model.ServerMessage {
+	return model.ServerMessage{
+		Setup:      f.Setup,
+		Directions: f.Directions,
+		Visibles:   f.Visibles,
+		Picks:      f.Picks,
+	}
+}
+
+// HasMessage is false for frames carrying only extensions
+func (f ServerFrame) HasMessage() bool {
+	return len(f.Setup)+len(f.Directions)+len(f.Visibles)+len(f.Picks) > 0
+}
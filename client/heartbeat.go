@@ -0,0 +1,151 @@
+package client
+
+import (
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const latencyWindow = 20
+
+// Heartbeat configures websocket pings, Interval 0 disables them.
+// Connection without pong for Interval+Timeout is considered dead.
+type Heartbeat struct {
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+func DefaultHeartbeat() Heartbeat {
+	return Heartbeat{
+		Interval: 2 * time.Second,
+		Timeout:  5 * time.Second,
+	}
+}
+
+// LatencyStats are rolling round trip statistics over last latencyWindow pongs.
+type LatencyStats struct {
+	Samples int
+	Last    time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	// Jitter is mean difference of consecutive round trips
+	Jitter time.Duration
+}
+
+type latency struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	count   int
+}
+
+func (l *latency) add(rtt time.Duration) {
+	l.mu.Lock()
+	l.samples[l.count%latencyWindow] = rtt
+	l.count++
+	l.mu.Unlock()
+}
+
+func (l *latency) reset() {
+	l.mu.Lock()
+	l.count = 0
+	l.mu.Unlock()
+}
+
+func (l *latency) stats() LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.count
+	if n > latencyWindow {
+		n = latencyWindow
+	}
+	if n == 0 {
+		return LatencyStats{}
+	}
+	st := LatencyStats{Samples: n, Last: l.samples[(l.count-1)%latencyWindow]}
+	var sum, diffs time.Duration
+	var prev time.Duration
+	// oldest to newest
+	for i := 0; i < n; i++ {
+		rtt := l.samples[(l.count-n+i)%latencyWindow]
+		if i == 0 || rtt < st.Min {
+			st.Min = rtt
+		}
+		if rtt > st.Max {
+			st.Max = rtt
+		}
+		if i > 0 {
+			d := rtt - prev
+			if d < 0 {
+				d = -d
+			}
+			diffs += d
+		}
+		sum += rtt
+		prev = rtt
+	}
+	st.Mean = sum / time.Duration(n)
+	if n > 1 {
+		st.Jitter = diffs / time.Duration(n-1)
+	}
+	return st
+}
+
+// Latency returns round trip statistics of current connection
+func (gs *GameSession) Latency() LatencyStats {
+	return gs.latency.stats()
+}
+
+// startHeartbeat installs pong handler, read deadline is moved forward
+// with every pong so silent server ends LoopChannelRead with timeout
+func (gs *GameSession) startHeartbeat() {
+	gs.latency.reset()
+	if gs.Heartbeat.Interval <= 0 {
+		return
+	}
+	gs.Conn.SetReadDeadline(time.Now().Add(gs.Heartbeat.Interval + gs.Heartbeat.Timeout))
+	conn := gs.Conn
+	conn.SetPongHandler(func(payload string) error {
+		sent, err := strconv.ParseInt(payload, 10, 64)
+		if err == nil {
+			rtt := time.Since(time.Unix(0, sent))
+			gs.latency.add(rtt)
+			log.Debugf("GameSession pong rtt %v", rtt)
+		}
+		if gs.ctx.Err() != nil {
+			// closing, keep closeTimeout deadline
+			return nil
+		}
+		return conn.SetReadDeadline(time.Now().Add(gs.Heartbeat.Interval + gs.Heartbeat.Timeout))
+	})
+	gs.loops.Add(1)
+	go gs.LoopHeartbeat()
+}
+
+func (gs *GameSession) LoopHeartbeat() {
+	defer gs.loops.Done()
+	log.Printf("GameSession.LoopHeartbeat STARTED")
+	ticker := time.NewTicker(gs.Heartbeat.Interval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			payload := strconv.FormatInt(time.Now().UnixNano(), 10)
+			err := gs.Conn.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(gs.Heartbeat.Timeout))
+			if err != nil {
+				// LoopChannelRead notices dead connection by deadline
+				log.Warnf("GameSession.LoopHeartbeat ping %v", err)
+			}
+			if st := gs.latency.stats(); st.Samples == latencyWindow && gs.pings%latencyWindow == 0 {
+				log.Infof("GameSession latency mean %v jitter %v min %v max %v", st.Mean, st.Jitter, st.Min, st.Max)
+			}
+			gs.pings++
+		case <-gs.connDone:
+			break loop
+		}
+	}
+	log.Printf("GameSession.LoopHeartbeat ENDED")
+}
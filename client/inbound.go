@@ -0,0 +1,80 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"sync"
+	"time"
+)
+
+// InboundLimits bound the inbound queue, 0 means unlimited. Exceeding them
+// means the game loop cannot keep up and the session forces resync.
+type InboundLimits struct {
+	MaxMessages int
+	// MaxAge is longest time the oldest message may wait for Loop
+	MaxAge time.Duration
+}
+
+func DefaultInboundLimits() InboundLimits {
+	return InboundLimits{
+		MaxMessages: 1024,
+		MaxAge:      5 * time.Second,
+	}
+}
+
+type inboundMessage struct {
+	received time.Time
+	sm       model.ServerMessage
+}
+
+// InboundQueue passes ServerMessages from LoopChannelRead to Loop. Unlike
+// channel it never drops a message silently, Push reports limits exceeded.
+type InboundQueue struct {
+	Limits InboundLimits
+
+	mu       sync.Mutex
+	messages []inboundMessage
+}
+
+func NewInboundQueue(limits InboundLimits) *InboundQueue {
+	return &InboundQueue{Limits: limits}
+}
+
+// Push returns false and keeps queue untouched when limits are exceeded
+func (q *InboundQueue) Push(sm model.ServerMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	if q.Limits.MaxMessages > 0 && len(q.messages) >= q.Limits.MaxMessages {
+		return false
+	}
+	if q.Limits.MaxAge > 0 && len(q.messages) > 0 && now.Sub(q.messages[0].received) > q.Limits.MaxAge {
+		return false
+	}
+	q.messages = append(q.messages, inboundMessage{received: now, sm: sm})
+	return true
+}
+
+func (q *InboundQueue) Pop() (model.ServerMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.messages) == 0 {
+		return model.ServerMessage{}, false
+	}
+	sm := q.messages[0].sm
+	q.messages[0] = inboundMessage{}
+	q.messages = q.messages[1:]
+	return sm, true
+}
+
+func (q *InboundQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+// Reset drops everything queued, used when model is going to be resynced
+func (q *InboundQueue) Reset() {
+	q.mu.Lock()
+	q.messages = nil
+	q.mu.Unlock()
+}
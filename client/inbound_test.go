@@ -0,0 +1,153 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/zucenko/roader/model"
+	"testing"
+	"time"
+)
+
+func TestInboundQueueLimits(t *testing.T) {
+	q := NewInboundQueue(InboundLimits{MaxMessages: 2})
+	for i := 0; i < 2; i++ {
+		if !q.Push(model.ServerMessage{Picks: []model.Pick{{Keys: i}}}) {
+			t.Fatalf("push %d refused", i)
+		}
+	}
+	if q.Push(model.ServerMessage{}) || q.Len() != 2 {
+		t.Fatalf("push over MaxMessages accepted, %d queued", q.Len())
+	}
+	if sm, _ := q.Pop(); sm.Picks[0].Keys != 0 {
+		t.Errorf("popped %+v first", sm)
+	}
+	if !q.Push(model.ServerMessage{}) {
+		t.Error("push refused after pop")
+	}
+	q.Reset()
+	if _, ok := q.Pop(); ok || q.Len() != 0 {
+		t.Error("messages left after Reset")
+	}
+
+	q = NewInboundQueue(InboundLimits{MaxAge: 20 * time.Millisecond})
+	q.Push(model.ServerMessage{})
+	time.Sleep(30 * time.Millisecond)
+	if q.Push(model.ServerMessage{}) {
+		t.Error("push behind message older than MaxAge accepted")
+	}
+	q.Pop()
+	if !q.Push(model.ServerMessage{}) {
+		t.Error("push refused once old message was popped")
+	}
+}
+
+func TestOverflowResyncs(t *testing.T) {
+	transport := NewPipeTransport("roader.gob")
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 0
+	gs.Backoff = Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1}
+	gs.MessagesIn.Limits = InboundLimits{MaxMessages: 1}
+	states := gs.Subscribe()
+
+	send := func(c *PipeConn, sm model.ServerMessage) {
+		var frame bytes.Buffer
+		GobCodec{}.Encode(&frame, sm)
+		c.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+	}
+	setup := model.ServerMessage{Setup: []model.Setup{{Cols: 3, Rows: 2, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 1}}}}}
+	flood := make(chan struct{})
+	go func() {
+		first := <-transport.Accept()
+		send(first, model.ServerMessage{Setup: setup.Setup, Visibles: []model.Visibilize{{Col: 1, Row: 1}}})
+		<-flood
+		// Loop is not running, second message does not fit
+		send(first, model.ServerMessage{Visibles: []model.Visibilize{{Col: 0, Row: 0}}})
+		send(first, model.ServerMessage{Visibles: []model.Visibilize{{Col: 2, Row: 1}}})
+		second := <-transport.Accept()
+		send(second, setup)
+		// answer the goodbye
+		for {
+			if _, _, err := second.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for gs.Model == nil && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Model == nil || !gs.Known(1, 1) {
+		t.Fatal("Setup not applied")
+	}
+	m := gs.Model
+	close(flood)
+
+	var overflow error
+	for overflow == nil {
+		select {
+		case e := <-states:
+			if e.State == CS_RECONNECTING {
+				overflow = e.Err
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no reconnect after overflow")
+		}
+	}
+	if ErrorKindOf(overflow) != ERR_OVERFLOW {
+		t.Errorf("reconnecting after %v", overflow)
+	}
+	for gs.Model == m && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Model == m {
+		t.Fatal("Setup after overflow resumed the stale model")
+	}
+	if gs.Known(1, 1) {
+		t.Error("known cells kept after resync")
+	}
+
+	// resync is one-shot, later Setup of the same game resumes again
+	m = gs.Model
+	gs.apply(setup)
+	if gs.Model != m {
+		t.Error("Setup after resync rebuilt the model")
+	}
+}
+
+func TestFrameBudget(t *testing.T) {
+	gs := NewGameSession(DefaultConfig())
+	gs.MessagesIn.Push(model.ServerMessage{Setup: []model.Setup{{Cols: 3, Rows: 2, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 1}}}}})
+	visibles := func(n int) {
+		for i := 0; i < n; i++ {
+			gs.MessagesIn.Push(model.ServerMessage{Visibles: []model.Visibilize{{Col: i % 3, Row: i % 2}}})
+		}
+	}
+	visibles(9)
+	if applied := gs.Loop(); applied != 10 || gs.LastLoop.Applied != 10 || gs.LastLoop.Pending != 0 {
+		t.Fatalf("without budget applied %d, last loop %+v", applied, gs.LastLoop)
+	}
+
+	visibles(10)
+	gs.FrameBudget = time.Nanosecond
+	for pending := 10; pending > 0; pending-- {
+		gs.Loop()
+		// budget spent by the first message, still it is applied
+		if gs.LastLoop.Applied != 1 || gs.LastLoop.Pending != pending-1 {
+			t.Fatalf("with tiny budget %+v, want 1 applied %d pending", gs.LastLoop, pending-1)
+		}
+	}
+	if gs.Loop(); gs.LastLoop.Applied != 0 || gs.LastLoop.Pending != 0 {
+		t.Errorf("empty queue %+v", gs.LastLoop)
+	}
+}
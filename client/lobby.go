@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Room is game waiting for players or already running
+type Room struct {
+	Id   string
+	Name string
+	// Code is invite code, sent only to the creator and with private rooms
+	// hidden from List
+	Code    string
+	Private bool
+	Cols    int
+	Rows    int
+	// Players is how many players the game starts with
+	Players int
+	// Waiting are keys of players connected to the room
+	Waiting []int32
+	Names   map[int32]string
+	Started bool
+}
+
+type RoomSettings struct {
+	Name       string
+	Cols, Rows int
+	Players    int
+	Private    bool
+}
+
+// LobbyRequest is sent by client on lobby connection, one of List, Create
+// and Code is set. Id is echoed in the reply.
+type LobbyRequest struct {
+	Id     int
+	List   bool
+	Create *RoomSettings
+	// Code looks up room by invite code
+	Code string
+}
+
+// LobbyMessage is reply to LobbyRequest or, with ReplyTo 0, room list pushed
+// whenever a room changes
+type LobbyMessage struct {
+	ReplyTo int
+	Rooms   []Room
+	Room    *Room
+	Err     string
+}
+
+var ErrLobbyClosed = errors.New("lobby closed")
+
+// ErrNoRoom is returned when server replied without room nor error
+var ErrNoRoom = errors.New("lobby: reply without room")
+
+// Lobby is connection to server lobby used before GameSession joins a room
+type Lobby struct {
+	Conn  Conn
+	codec Codec
+
+	mu      sync.Mutex
+	rooms   []Room
+	nextId  int
+	replies map[int]chan LobbyMessage
+	err     error
+	writing sync.Mutex
+	done    chan struct{}
+}
+
+// DialLobby connects to lobby at cfg.LobbyPath, JSON is used whatever codec
+// the game uses
+func DialLobby(ctx context.Context, cfg Config, transport Transport) (*Lobby, error) {
+	if transport == nil {
+		t, err := NewWebsocketTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+	u := url.URL{Scheme: cfg.Scheme, Host: cfg.Host, Path: cfg.LobbyPath}
+	codec := JSONCodec{}
+	c, err := transport.Dial(ctx, u, cfg.Header(), []string{Subprotocol(codec)})
+	if err != nil {
+		return nil, newError(ERR_DIAL, err)
+	}
+	l := &Lobby{
+		Conn:    c,
+		codec:   codec,
+		replies: make(map[int]chan LobbyMessage),
+		done:    make(chan struct{}),
+	}
+	go l.LoopChannelRead()
+	return l, nil
+}
+
+// Rooms is the latest room list pushed by server
+func (l *Lobby) Rooms() []Room {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rooms
+}
+
+// Room returns the room from latest list
+func (l *Lobby) Room(id string) (Room, bool) {
+	for _, r := range l.Rooms() {
+		if r.Id == id {
+			return r, true
+		}
+	}
+	return Room{}, false
+}
+
+func (l *Lobby) List(ctx context.Context) ([]Room, error) {
+	lm, err := l.request(ctx, LobbyRequest{List: true})
+	return lm.Rooms, err
+}
+
+// Create makes new room, returned Room carries invite code
+func (l *Lobby) Create(ctx context.Context, settings RoomSettings) (Room, error) {
+	lm, err := l.request(ctx, LobbyRequest{Create: &settings})
+	if err != nil {
+		return Room{}, err
+	}
+	if lm.Room == nil {
+		return Room{}, ErrNoRoom
+	}
+	return *lm.Room, nil
+}
+
+// Find looks up room by invite code
+func (l *Lobby) Find(ctx context.Context, code string) (Room, error) {
+	lm, err := l.request(ctx, LobbyRequest{Code: code})
+	if err != nil {
+		return Room{}, err
+	}
+	if lm.Room == nil {
+		return Room{}, ErrNoRoom
+	}
+	return *lm.Room, nil
+}
+
+func (l *Lobby) request(ctx context.Context, req LobbyRequest) (LobbyMessage, error) {
+	l.mu.Lock()
+	if l.err != nil {
+		l.mu.Unlock()
+		return LobbyMessage{}, l.err
+	}
+	l.nextId++
+	req.Id = l.nextId
+	reply := make(chan LobbyMessage, 1)
+	l.replies[req.Id] = reply
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.replies, req.Id)
+		l.mu.Unlock()
+	}()
+
+	if err := l.write(req); err != nil {
+		return LobbyMessage{}, err
+	}
+	select {
+	case lm := <-reply:
+		if lm.Err != "" {
+			return lm, fmt.Errorf("lobby: %s", lm.Err)
+		}
+		return lm, nil
+	case <-l.done:
+		return LobbyMessage{}, l.Err()
+	case <-ctx.Done():
+		return LobbyMessage{}, ctx.Err()
+	}
+}
+
+func (l *Lobby) write(req LobbyRequest) error {
+	l.writing.Lock()
+	defer l.writing.Unlock()
+	w, err := l.Conn.NextWriter(l.codec.MessageType())
+	if err != nil {
+		return newError(ERR_WRITE, err)
+	}
+	if err := l.codec.Encode(w, req); err != nil {
+		return newError(ERR_ENCODE, err)
+	}
+	if err := w.Close(); err != nil {
+		return newError(ERR_WRITE, err)
+	}
+	return nil
+}
+
+func (l *Lobby) LoopChannelRead() {
+	defer close(l.done)
+	for {
+		_, r, err := l.Conn.NextReader()
+		if err != nil {
+			l.fail(newError(ERR_READ, err))
+			return
+		}
+		lm := LobbyMessage{}
+		if err := l.codec.Decode(r, &lm); err != nil {
+			l.fail(newError(ERR_DECODE, err))
+			return
+		}
+		l.mu.Lock()
+		if lm.ReplyTo == 0 || lm.Rooms != nil {
+			l.rooms = lm.Rooms
+		}
+		// the first reply is taken, repeated one finds no waiter
+		reply := l.replies[lm.ReplyTo]
+		delete(l.replies, lm.ReplyTo)
+		l.mu.Unlock()
+		if reply != nil {
+			reply <- lm
+		}
+	}
+}
+
+func (l *Lobby) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err == nil {
+		log.Printf("Lobby ended %v", err)
+		l.err = err
+	}
+}
+
+func (l *Lobby) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Done is closed when lobby connection ended
+func (l *Lobby) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *Lobby) Close() error {
+	l.fail(ErrLobbyClosed)
+	l.writing.Lock()
+	l.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(closeTimeout))
+	l.writing.Unlock()
+	err := l.Conn.Close()
+	<-l.done
+	return err
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLobbyOddReplies(t *testing.T) {
+	transport := NewPipeTransport(Subprotocol(JSONCodec{}))
+	go func() {
+		server := <-transport.Accept()
+		for {
+			_, r, err := server.NextReader()
+			if err != nil {
+				return
+			}
+			req := LobbyRequest{}
+			if err := (JSONCodec{}).Decode(r, &req); err != nil {
+				t.Error(err)
+				return
+			}
+			// reply without room, twice
+			var frame bytes.Buffer
+			JSONCodec{}.Encode(&frame, LobbyMessage{ReplyTo: req.Id})
+			for i := 0; i < 2; i++ {
+				server.WriteMessage(JSONCodec{}.MessageType(), frame.Bytes())
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	lobby, err := DialLobby(ctx, DefaultConfig(), transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lobby.Close()
+	if _, err := lobby.Create(ctx, RoomSettings{Cols: 5, Rows: 5, Players: 1}); err != ErrNoRoom {
+		t.Errorf("create: %v", err)
+	}
+	// repeated reply must not stall the read loop
+	if _, err := lobby.Find(ctx, "abc"); err != ErrNoRoom {
+		t.Errorf("find: %v", err)
+	}
+}
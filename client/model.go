@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"github.com/zucenko/roader/model"
+	"sync"
+	"time"
+)
+
+// LoopStats describe the last Loop call, for diagnostics
+type LoopStats struct {
+	Applied int
+	// Pending messages left for next frame
+	Pending int
+	Took    time.Duration
+}
+
+type GameSession struct {
+	Conn        Conn
+	Config      Config
+	Transport   Transport // websocket built from Config when nil
+	Codec       Codec
+	PlayerKey   int32
+	PlayerIndex int
+	Model       *model.Model
+	Backoff     Backoff
+	Heartbeat   Heartbeat
+	Errors      chan error
+	MessagesOut chan model.ClientMessage
+	MessagesIn  *InboundQueue
+	ChatOut     chan ChatMessage
+	Chat        *ChatLog
+	// FrameBudget limits time Loop spends applying messages, 0 applies all
+	FrameBudget time.Duration
+	LastLoop    LoopStats
+	// Recorder gets every message passing the session, nil records nothing.
+	// It is closed when the session ends.
+	Recorder *Recorder
+	// Mispredicted counts own moves the server decided differently than
+	// the local prediction
+	Mispredicted int
+
+	// message or frame taken from MessagesOut or ChatOut but not written
+	// before the connection dropped
+	pending interface{}
+	// coder is Codec negotiated for current connection
+	coder Codec
+	// closed when the current connection is torn down, stops LoopChannelWrite
+	connDone chan struct{}
+	// resuming is set for connection redialed as assigned player
+	resuming bool
+	loops    sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closed when LoopReconnect ended
+	done        chan struct{}
+	mu          sync.Mutex
+	err         error
+	state       ConnState
+	subscribers []chan StateEvent
+	latency     latency
+	// extensions announced by server with the last Setup
+	extensions []string
+	names      map[int32]string
+	// resync is set when inbound limits were exceeded, next Setup rebuilds Model
+	resync int32
+	pings  int
+	// own moves sent and not answered by server yet
+	unanswered int
+	// own moves applied ahead of server reply, oldest first
+	predictions []*prediction
+	seq         uint32
+	// own moves refused by server, taken by Rejected
+	rejects []Reject
+	travel  *travel
+	// known cells were visible at least once, indexed like Model.Matrix
+	known [][]bool
+}
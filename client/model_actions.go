@@ -0,0 +1,535 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roader/model"
+	"net"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const closeTimeout = time.Second
+
+func NewGameSession(cfg Config) *GameSession {
+	return &GameSession{
+		Config:      cfg,
+		PlayerKey:   cfg.PlayerKey(),
+		Backoff:     DefaultBackoff(),
+		Heartbeat:   DefaultHeartbeat(),
+		Errors:      make(chan error, 2),
+		MessagesOut: make(chan model.ClientMessage, 10),
+		MessagesIn:  NewInboundQueue(DefaultInboundLimits()),
+		ChatOut:     make(chan ChatMessage, 10),
+		Chat:        NewChatLog(chatLogSize),
+		done:        make(chan struct{}),
+	}
+}
+
+// asynchro call, session lives until ctx is cancelled or Close is called
+func (gs *GameSession) Connect(ctx context.Context) error {
+	codec, err := CodecByName(gs.Config.Codec)
+	if err != nil {
+		return err
+	}
+	gs.Codec = codec
+	if gs.Transport == nil {
+		transport, err := NewWebsocketTransport(gs.Config)
+		if err != nil {
+			return err
+		}
+		gs.Transport = transport
+	}
+	gs.ctx, gs.cancel = context.WithCancel(ctx)
+
+	gs.setState(StateEvent{State: CS_CONNECTING})
+	c, err := gs.dial()
+	if err != nil {
+		log.Warnf("dial: %v", err)
+		gs.cancel()
+		gs.setState(StateEvent{State: CS_CLOSED, Err: err})
+		gs.closeRecorder()
+		close(gs.done)
+		return err
+	}
+	gs.start(c)
+	go gs.LoopReconnect()
+
+	return nil
+}
+
+// Close stops reconnecting, flushes MessagesOut, sends close frame and waits
+// for both loops to exit. Returned error is the one which ended the session.
+func (gs *GameSession) Close() error {
+	if gs.cancel == nil {
+		return nil
+	}
+	gs.cancel()
+	<-gs.done
+	return gs.Err()
+}
+
+// Done is closed when session finished after Close or ctx cancel
+func (gs *GameSession) Done() <-chan struct{} {
+	return gs.done
+}
+
+// Err is the last connection error as *SessionError, nil after clean shutdown
+func (gs *GameSession) Err() error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return gs.err
+}
+
+// dial opens websocket to configured server, once the server assigned us a player
+// the key is sent along so the server can resume the same player
+func (gs *GameSession) dial() (Conn, error) {
+	q := url.Values{}
+	if gs.Config.Room != "" {
+		q.Set("room", gs.Config.Room)
+	}
+	if gs.Config.Invite != "" {
+		q.Set("invite", gs.Config.Invite)
+	}
+	if gs.Config.Name != "" {
+		q.Set("name", gs.Config.Name)
+	}
+	if gs.Spectating() {
+		q.Set("spectate", "1")
+	} else if key := atomic.LoadInt32(&gs.PlayerKey); key != 0 {
+		q.Set("player", strconv.Itoa(int(key)))
+	}
+	u := gs.Config.URL()
+	u.RawQuery = q.Encode()
+	log.Printf("connecting to %s", u.String())
+
+	c, err := gs.Transport.Dial(gs.ctx, u, gs.Config.Header(), Subprotocols(gs.Codec))
+	if errors.Is(err, ErrRefused) {
+		return nil, newError(ERR_REJECTED, err)
+	}
+	if err != nil {
+		return nil, newError(ERR_DIAL, err)
+	}
+	return c, nil
+}
+
+func (gs *GameSession) start(c Conn) {
+	gs.Conn = c
+	gs.coder = Negotiated(gs.Codec, c.Subprotocol())
+	log.Printf("GameSession codec %s subprotocol %q", gs.coder.Name(), c.Subprotocol())
+	gs.connDone = make(chan struct{})
+	gs.loops.Add(2)
+	gs.startHeartbeat()
+	gs.setState(StateEvent{State: CS_CONNECTED})
+	go gs.LoopChannelRead()
+	go gs.LoopChannelWrite()
+}
+
+// LoopReconnect waits for read or write loop failure, tears the connection down
+// and dials the same server again with exponential backoff. Session the server
+// rejected ends with ERR_REJECTED. On ctx cancel it shuts the connection down
+// gracefully and closes Done.
+func (gs *GameSession) LoopReconnect() {
+	log.Printf("GameSession.LoopReconnect STARTED")
+	defer close(gs.done)
+	defer gs.closeRecorder()
+	for {
+		var err error
+		select {
+		case err = <-gs.Errors:
+		case <-gs.ctx.Done():
+			err = gs.shutdown()
+			gs.setState(StateEvent{State: CS_CLOSED, Err: err})
+			log.Printf("GameSession.LoopReconnect ENDED")
+			return
+		}
+		gs.teardown()
+		if ErrorKindOf(err) == ERR_REJECTED {
+			gs.setState(StateEvent{State: CS_CLOSED, Err: err})
+			log.Printf("GameSession.LoopReconnect ENDED, server rejected the session")
+			return
+		}
+		if err := gs.redial(err); err != nil {
+			gs.setState(StateEvent{State: CS_CLOSED, Err: err})
+			log.Printf("GameSession.LoopReconnect ENDED while reconnecting")
+			return
+		}
+	}
+}
+
+func (gs *GameSession) teardown() {
+	close(gs.connDone)
+	gs.Conn.Close()
+	gs.loops.Wait()
+drain:
+	for {
+		select {
+		case <-gs.Errors:
+		default:
+			break drain
+		}
+	}
+}
+
+// shutdown lets LoopChannelWrite flush and say goodbye, LoopChannelRead ends
+// on server close reply or closeTimeout. When goodbye could not be said the
+// connection is closed after closeTimeout, so the read loop never waits for
+// a reply that is not coming.
+func (gs *GameSession) shutdown() error {
+	close(gs.connDone)
+	ended := make(chan struct{})
+	go func() {
+		gs.loops.Wait()
+		close(ended)
+	}()
+	select {
+	case <-ended:
+	case <-time.After(closeTimeout):
+		log.Warnf("GameSession.shutdown loops still running after %v, closing", closeTimeout)
+		gs.Conn.Close()
+		<-ended
+	}
+	gs.Conn.Close()
+	select {
+	case err := <-gs.Errors:
+		return err
+	default:
+		return nil
+	}
+}
+
+// redial returns nil once connected again, otherwise the error ending the
+// session: rejected dial, or err that dropped the connection when ctx was
+// cancelled meanwhile
+func (gs *GameSession) redial(err error) error {
+	for {
+		d := gs.Backoff.Next()
+		log.Warnf("GameSession.LoopReconnect connection lost, attempt %d in %v", gs.Backoff.Attempt(), d)
+		gs.setState(StateEvent{State: CS_RECONNECTING, Err: err, Attempt: gs.Backoff.Attempt()})
+		select {
+		case <-time.After(d):
+		case <-gs.ctx.Done():
+			return err
+		}
+		c, dialErr := gs.dial()
+		if dialErr != nil {
+			if gs.ctx.Err() != nil {
+				return err
+			}
+			log.Warnf("GameSession.LoopReconnect dial: %v", dialErr)
+			if ErrorKindOf(dialErr) == ERR_REJECTED {
+				return dialErr
+			}
+			err = dialErr
+			continue
+		}
+		gs.Backoff.Reset()
+		gs.resuming = atomic.LoadInt32(&gs.PlayerKey) != 0 && !gs.Spectating()
+		gs.start(c)
+		return nil
+	}
+}
+
+func (gs *GameSession) LoopChannelRead() {
+	defer gs.loops.Done()
+	log.Printf("LoopChannelRead STARTED")
+	setup := false
+loop:
+	for {
+		messageType, r, err := gs.Conn.NextReader()
+		if err != nil {
+			if gs.ctx.Err() != nil {
+				log.Printf("LoopChannelRead closing %v", err)
+				break loop
+			}
+			log.Warnf("LoopChannelRead err %v", err)
+			refused := websocket.IsCloseError(err, websocket.ClosePolicyViolation)
+			if refused && (!gs.resuming || setup) {
+				gs.Errors <- newError(ERR_REJECTED, err)
+			} else if refused || websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				// resume refused before Setup is retried, server may not have
+				// noticed our dropped connection yet
+				gs.Errors <- newError(ERR_CLOSED, err)
+			} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				gs.Errors <- newError(ERR_TIMEOUT, err)
+			} else {
+				gs.Errors <- newError(ERR_READ, err)
+			}
+			break loop
+		}
+		log.Printf("LoopChannelRead received  message type: %d", messageType)
+		frame := ServerFrame{}
+		err = gs.coder.Decode(r, &frame)
+		if err != nil {
+			log.Warnf("cant decode message %v", err)
+			gs.Errors <- newError(ERR_DECODE, err)
+			break loop
+		}
+		log.Debugf("mess %v", frame)
+		if len(frame.Setup) > 0 {
+			setup = true
+			gs.mu.Lock()
+			gs.extensions = frame.Extensions
+			gs.mu.Unlock()
+		}
+		if frame.Names != nil {
+			gs.setNames(frame.Names)
+			if gs.Recorder != nil {
+				gs.Recorder.Named(frame.Names)
+			}
+		}
+		for _, m := range frame.Chat {
+			gs.Chat.Add(m)
+			if gs.Recorder != nil {
+				gs.Recorder.Chatted(m)
+			}
+		}
+		if !frame.HasMessage() {
+			continue
+		}
+		sm := frame.Message()
+		if gs.Recorder != nil {
+			gs.Recorder.Received(sm)
+		}
+		if !gs.MessagesIn.Push(sm) {
+			// lost message would desync the model forever, start over from fresh Setup
+			log.Warnf("LoopChannelRead gs.MessagesIn over limits with %d messages, resync", gs.MessagesIn.Len())
+			atomic.StoreInt32(&gs.resync, 1)
+			gs.MessagesIn.Reset()
+			gs.Errors <- newError(ERR_OVERFLOW, fmt.Errorf("inbound queue over %+v", gs.MessagesIn.Limits))
+			break loop
+		}
+	}
+	log.Printf("LoopChannelRead ENDED")
+}
+
+// this function only consumes. no worries about full buffer stuck
+// message which failed to be written is kept and sent first after reconnect
+func (gs *GameSession) LoopChannelWrite() {
+	defer gs.loops.Done()
+	log.Printf("GameSession.LoopChannelWrite STARTED")
+loop:
+	for {
+		var cm interface{}
+		if gs.pending != nil {
+			cm, gs.pending = gs.pending, nil
+		} else {
+			select {
+			case cm = <-gs.MessagesOut:
+			case m := <-gs.ChatOut:
+				cm = ClientFrame{Move: NoMove, Chat: &m}
+			case <-gs.connDone:
+				if gs.ctx.Err() != nil {
+					if err := gs.goodbye(); err != nil {
+						log.Warnf("GameSession.LoopChannelWrite goodbye %v", err)
+						gs.Errors <- err
+					}
+				}
+				break loop
+			}
+		}
+		log.Printf("GameSession.LoopChannelWrite have message")
+		if err := gs.write(cm); err != nil {
+			log.Warnf("GameSession.LoopChannelWrite %v", err)
+			gs.pending = cm
+			gs.Errors <- err
+			break loop
+		}
+	}
+	log.Printf("LoopChannelWrite ENDED")
+}
+
+// goodbye writes messages still waiting in MessagesOut and sends close frame
+func (gs *GameSession) goodbye() error {
+flush:
+	for {
+		select {
+		case cm := <-gs.MessagesOut:
+			if err := gs.write(cm); err != nil {
+				return err
+			}
+		default:
+			break flush
+		}
+	}
+	deadline := time.Now().Add(closeTimeout)
+	err := gs.Conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		deadline)
+	if err != nil {
+		return newError(ERR_WRITE, fmt.Errorf("cant send close: %w", err))
+	}
+	return gs.Conn.SetReadDeadline(deadline)
+}
+
+// write encodes model.ClientMessage or ClientFrame
+func (gs *GameSession) write(cm interface{}) error {
+	w, err := gs.Conn.NextWriter(gs.coder.MessageType())
+	if err != nil {
+		return newError(ERR_WRITE, fmt.Errorf("cant get writer: %w", err))
+	}
+	err = gs.coder.Encode(w, cm)
+	if err != nil {
+		return newError(ERR_ENCODE, fmt.Errorf("cant encode: %w", err))
+	}
+	err = w.Close()
+	if err != nil {
+		return newError(ERR_WRITE, fmt.Errorf("cant Close: %w", err))
+	}
+	if m, ok := cm.(model.ClientMessage); ok && gs.Recorder != nil {
+		gs.Recorder.Sent(m)
+	}
+	return nil
+}
+
+// Loop applies every queued ServerMessage to Model, called once per frame.
+// With FrameBudget set it stops after the budget is spent, leaving the rest
+// for next frame; at least one message is always applied.
+// Returns number of applied messages.
+func (gs *GameSession) Loop() int {
+	start := time.Now()
+	applied := 0
+	for gs.FrameBudget <= 0 || applied == 0 || time.Since(start) < gs.FrameBudget {
+		sm, found := gs.MessagesIn.Pop()
+		if !found {
+			break
+		}
+		gs.apply(sm)
+		applied++
+	}
+	gs.travelStep()
+	gs.LastLoop = LoopStats{Applied: applied, Pending: gs.MessagesIn.Len(), Took: time.Since(start)}
+	return applied
+}
+
+func (gs *GameSession) apply(sm model.ServerMessage) {
+	log.Debug(sm)
+	// server messages apply to confirmed state, predictions go on top again
+	gs.rollback()
+	defer gs.replay()
+	if len(sm.Setup) == 1 {
+		gs.predictions = nil
+		gs.unanswered = 0
+		gs.travel = nil
+		setup := sm.Setup[0]
+		resync := atomic.CompareAndSwapInt32(&gs.resync, 1, 0)
+		if !resync && gs.resumed(setup) {
+			log.Infof("resumed as: %v", gs.PlayerKey)
+			gs.syncPlayers(setup.Players)
+		} else {
+			atomic.StoreInt32(&gs.PlayerKey, setup.PlayerKey)
+			log.Infof("playing as: %v", gs.PlayerKey)
+			gs.Model = model.NewEmptyModel(setup.Cols, setup.Rows, setup.Players)
+			gs.resetKnown(setup.Cols, setup.Rows)
+		}
+	}
+
+	for _, directionSuccess := range sm.Directions {
+		gs.acknowledge(directionSuccess)
+		if !directionSuccess.Success && gs.own(directionSuccess) && !gs.Spectating() {
+			gs.reject(directionSuccess)
+		}
+		gs.travelReply(directionSuccess)
+		if directionSuccess.Success {
+			player := gs.Model.Players[directionSuccess.PlayerKey]
+			var cell = gs.Model.Matrix[player.Col][player.Row]
+			var newCell *model.Cell
+			//nonportal
+			if directionSuccess.Direction < 4 {
+				newCell = cell.Paths[directionSuccess.Direction].Target
+				if gs.Spectating() {
+					if cell.Paths[directionSuccess.Direction].Wall {
+						// only locks are passable, opening one costs a key
+						player.Keys--
+					}
+					gs.collect(player, newCell)
+				}
+				cell.Paths[directionSuccess.Direction].Wall = false
+				cell.Paths[directionSuccess.Direction].Player = player
+				cell.Paths[directionSuccess.Direction].Target.Paths[(directionSuccess.Direction+2)%4].Player = player
+				cell.Paths[directionSuccess.Direction].Target.Paths[(directionSuccess.Direction+2)%4].Wall = false
+				newCell.Diamond = false
+				newCell.Key = false
+				cell.Crossings()
+				newCell.Crossings()
+			} else {
+				newCell = gs.Model.Matrix[directionSuccess.Col][directionSuccess.Row]
+				if gs.Spectating() {
+					gs.collect(player, newCell)
+				}
+			}
+			//newCell.Unhook(player.Id)
+
+			cell.Player = nil
+			newCell.Player = player
+			player.Row = directionSuccess.Row
+			player.Col = directionSuccess.Col
+		}
+	}
+
+	for _, v := range sm.Visibles {
+		cell := gs.Model.Matrix[v.Col][v.Row]
+		gs.known[v.Col][v.Row] = true
+		if len(v.Walls) == 4 {
+			for i, p := range cell.Paths {
+				if p != nil {
+					p.Wall = v.Walls[i]
+					p.Lock = v.Locks[i]
+					if p.Target != nil {
+						p.Target.Paths[(i+2)%4].Wall = v.Walls[i]
+						p.Target.Paths[(i+2)%4].Lock = v.Locks[i]
+					}
+				}
+			}
+		}
+		cell.Key = v.Key
+		cell.Diamond = v.Diamond
+		if v.Portal && cell.Portal == nil {
+			cell.Portal = &model.Portal{Target: gs.Model.Matrix[v.PortalToCol][v.PortalToRow]}
+			gs.Model.Matrix[v.PortalToCol][v.PortalToRow].Portal = &model.Portal{Target: cell}
+		}
+		if v.HasPlayer {
+			cell.Player = gs.Model.Players[v.PlayerId]
+		} else {
+			cell.Player = nil
+		}
+	}
+	for _, p := range sm.Picks {
+		if gs.Spectating() {
+			break
+		}
+		gs.Model.Players[gs.PlayerKey].Keys = p.Keys
+		gs.Model.Players[gs.PlayerKey].Diamonds = p.Diamonds
+	}
+}
+
+// resumed tells the Setup belongs to the game we already know, we reconnected
+// as the same player so the board discovered so far is kept
+func (gs *GameSession) resumed(setup model.Setup) bool {
+	return gs.Model != nil &&
+		gs.PlayerKey == setup.PlayerKey &&
+		len(gs.Model.Matrix) == setup.Cols &&
+		len(gs.Model.Matrix[0]) == setup.Rows
+}
+
+func (gs *GameSession) syncPlayers(players map[int32]model.Player) {
+	for id, p := range players {
+		player, found := gs.Model.Players[id]
+		if !found {
+			continue
+		}
+		cell := gs.Model.Matrix[player.Col][player.Row]
+		if cell.Player == player {
+			cell.Player = nil
+		}
+		player.Col, player.Row = p.Col, p.Row
+		player.Keys, player.Diamonds = p.Keys, p.Diamonds
+		gs.Model.Matrix[p.Col][p.Row].Player = player
+	}
+}
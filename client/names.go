@@ -0,0 +1,22 @@
+package client
+
+// Name is display name of player, the player key letter when server sent none
+func (gs *GameSession) Name(key int32) string {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if name := gs.names[key]; name != "" {
+		return name
+	}
+	return string(rune(key))
+}
+
+func (gs *GameSession) setNames(names map[int32]string) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	if gs.names == nil {
+		gs.names = make(map[int32]string)
+	}
+	for key, name := range names {
+		gs.names[key] = name
+	}
+}
@@ -0,0 +1,269 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const pipeBuffer = 64
+
+var errPipeClosed = errors.New("pipe: use of closed connection")
+
+type pipeTimeout struct{}
+
+func (pipeTimeout) Error() string   { return "pipe: i/o timeout" }
+func (pipeTimeout) Timeout() bool   { return true }
+func (pipeTimeout) Temporary() bool { return true }
+
+// PipeTransport connects GameSession to in-process server without network.
+// Every Dial creates connected pair of PipeConns, the server end is delivered
+// by Accept.
+type PipeTransport struct {
+	// Subprotocols server end supports, first one offered by client is chosen
+	Subprotocols []string
+	conns        chan *PipeConn
+}
+
+func NewPipeTransport(subprotocols ...string) *PipeTransport {
+	return &PipeTransport{
+		Subprotocols: subprotocols,
+		conns:        make(chan *PipeConn),
+	}
+}
+
+func (t *PipeTransport) Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (Conn, error) {
+	var chosen string
+offered:
+	for _, offer := range subprotocols {
+		for _, supported := range t.Subprotocols {
+			if offer == supported {
+				chosen = offer
+				break offered
+			}
+		}
+	}
+	client, server := NewPipe()
+	client.subprotocol, server.subprotocol = chosen, chosen
+	server.URL, server.Header = u, header
+	select {
+	case t.conns <- server:
+		return client, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Accept delivers server ends of dialed connections
+func (t *PipeTransport) Accept() <-chan *PipeConn {
+	return t.conns
+}
+
+type pipeFrame struct {
+	messageType int
+	data        []byte
+}
+
+type pipeEnd struct {
+	frames chan pipeFrame
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (e *pipeEnd) close() {
+	e.once.Do(func() { close(e.closed) })
+}
+
+// PipeConn is in-memory Conn, frames are delivered whole and in order.
+// Pings are answered and close frames echoed like gorilla websocket does.
+type PipeConn struct {
+	// URL and Header the client dialed with, set on server end
+	URL    url.URL
+	Header http.Header
+
+	local, remote *pipeEnd
+	subprotocol   string
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	deadlineMoved chan struct{}
+	pongHandler   func(string) error
+	closeSent     bool
+	writing       sync.Mutex
+}
+
+// NewPipe returns two connected ends
+func NewPipe() (*PipeConn, *PipeConn) {
+	a := &pipeEnd{frames: make(chan pipeFrame, pipeBuffer), closed: make(chan struct{})}
+	b := &pipeEnd{frames: make(chan pipeFrame, pipeBuffer), closed: make(chan struct{})}
+	return &PipeConn{local: a, remote: b, deadlineMoved: make(chan struct{}, 1)},
+		&PipeConn{local: b, remote: a, deadlineMoved: make(chan struct{}, 1)}
+}
+
+func (c *PipeConn) NextReader() (int, io.Reader, error) {
+	for {
+		c.mu.Lock()
+		deadline := c.readDeadline
+		c.mu.Unlock()
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !deadline.IsZero() {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+		var f pipeFrame
+		received := false
+		// frames written before peer closed are still delivered
+		select {
+		case f = <-c.local.frames:
+			received = true
+		default:
+		}
+		if !received {
+			select {
+			case f = <-c.local.frames:
+				received = true
+			case <-c.deadlineMoved:
+			case <-c.local.closed:
+				return 0, nil, errPipeClosed
+			case <-c.remote.closed:
+				return 0, nil, &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+			case <-timeout:
+				return 0, nil, pipeTimeout{}
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if !received {
+			continue
+		}
+		switch f.messageType {
+		case websocket.PingMessage:
+			c.WriteControl(websocket.PongMessage, f.data, time.Now().Add(time.Second))
+		case websocket.PongMessage:
+			c.mu.Lock()
+			h := c.pongHandler
+			c.mu.Unlock()
+			if h != nil {
+				if err := h(string(f.data)); err != nil {
+					return 0, nil, err
+				}
+			}
+		case websocket.CloseMessage:
+			c.mu.Lock()
+			echo := !c.closeSent
+			c.mu.Unlock()
+			if echo {
+				c.WriteControl(websocket.CloseMessage, f.data, time.Now().Add(time.Second))
+			}
+			ce := &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+			if len(f.data) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(f.data))
+				ce.Text = string(f.data[2:])
+			}
+			return 0, nil, ce
+		default:
+			return f.messageType, bytes.NewReader(f.data), nil
+		}
+	}
+}
+
+type pipeWriter struct {
+	conn        *PipeConn
+	messageType int
+	buf         bytes.Buffer
+}
+
+func (w *pipeWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *pipeWriter) Close() error {
+	return w.conn.send(pipeFrame{messageType: w.messageType, data: w.buf.Bytes()}, time.Time{})
+}
+
+func (c *PipeConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	select {
+	case <-c.local.closed:
+		return nil, errPipeClosed
+	default:
+	}
+	return &pipeWriter{conn: c, messageType: messageType}, nil
+}
+
+// WriteMessage is helper for in-process servers
+func (c *PipeConn) WriteMessage(messageType int, data []byte) error {
+	return c.send(pipeFrame{messageType: messageType, data: append([]byte(nil), data...)}, time.Time{})
+}
+
+func (c *PipeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType == websocket.CloseMessage {
+		c.mu.Lock()
+		c.closeSent = true
+		c.mu.Unlock()
+	}
+	return c.send(pipeFrame{messageType: messageType, data: append([]byte(nil), data...)}, deadline)
+}
+
+func (c *PipeConn) send(f pipeFrame, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	c.writing.Lock()
+	defer c.writing.Unlock()
+	select {
+	case <-c.local.closed:
+		return errPipeClosed
+	case <-c.remote.closed:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case c.remote.frames <- f:
+		return nil
+	case <-c.local.closed:
+		return errPipeClosed
+	case <-c.remote.closed:
+		return io.ErrClosedPipe
+	case <-timeout:
+		return pipeTimeout{}
+	}
+}
+
+func (c *PipeConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	// wake blocked NextReader to pick the new deadline
+	select {
+	case c.deadlineMoved <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (c *PipeConn) SetPongHandler(h func(appData string) error) {
+	c.mu.Lock()
+	c.pongHandler = h
+	c.mu.Unlock()
+}
+
+func (c *PipeConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *PipeConn) Close() error {
+	c.local.close()
+	return nil
+}
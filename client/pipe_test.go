@@ -0,0 +1,363 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/zucenko/roader/model"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionOverPipe(t *testing.T) {
+	transport := NewPipeTransport("roader.gob-stream")
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 10 * time.Millisecond
+
+	served := make(chan model.ClientMessage, 1)
+	go func() {
+		server := <-transport.Accept()
+		codec := Negotiated(GobCodec{}, server.Subprotocol())
+		var frame bytes.Buffer
+		codec.Encode(&frame, model.ServerMessage{Setup: []model.Setup{{
+			Cols: 3, Rows: 2, PlayerKey: 'A',
+			Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 1}}}}})
+		server.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+		for {
+			_, r, err := server.NextReader()
+			if err != nil {
+				return
+			}
+			var cm model.ClientMessage
+			if err := codec.Decode(r, &cm); err != nil {
+				t.Error(err)
+				return
+			}
+			served <- cm
+		}
+	}()
+
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gs.coder.(*gobStream); !ok {
+		t.Errorf("gob-stream not negotiated, got %T", gs.coder)
+	}
+	deadline := time.Now().Add(time.Second)
+	for gs.Model == nil && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Model == nil || gs.PlayerKey != 'A' || gs.Model.Matrix[1][1].Player == nil {
+		t.Fatal("Setup not applied")
+	}
+
+	gs.MessagesOut <- model.ClientMessage{Move: 2}
+	select {
+	case cm := <-served:
+		if cm.Move != 2 {
+			t.Errorf("server got move %d", cm.Move)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("move not delivered")
+	}
+	for gs.Latency().Samples == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Latency().Samples == 0 {
+		t.Error("no pong over pipe")
+	}
+	if err := gs.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if gs.State() != CS_CLOSED {
+		t.Errorf("state %s", gs.State().Name())
+	}
+}
+
+// brokenWrites fails writes of the client end once broken is closed
+type brokenWrites struct {
+	*PipeTransport
+	broken chan struct{}
+}
+
+type brokenConn struct {
+	Conn
+	broken chan struct{}
+}
+
+func (t *brokenWrites) Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (Conn, error) {
+	c, err := t.PipeTransport.Dial(ctx, u, header, subprotocols)
+	if err != nil {
+		return nil, err
+	}
+	return &brokenConn{c, t.broken}, nil
+}
+
+func (c *brokenConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	select {
+	case <-c.broken:
+		return errors.New("broken pipe")
+	default:
+		return c.Conn.WriteControl(messageType, data, deadline)
+	}
+}
+
+func TestCloseAfterFailedGoodbye(t *testing.T) {
+	transport := &brokenWrites{NewPipeTransport("roader.gob"), make(chan struct{})}
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 0
+	// server never answers nor closes, reading would block forever
+	go func() { <-transport.Accept() }()
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(transport.broken)
+
+	closed := make(chan error)
+	go func() { closed <- gs.Close() }()
+	select {
+	case err := <-closed:
+		if ErrorKindOf(err) != ERR_WRITE {
+			t.Errorf("close: %v", err)
+		}
+	case <-time.After(3 * closeTimeout):
+		t.Fatal("Close hangs")
+	}
+}
+
+// failingDials refuses the dials listed in fail (counted from 0) and records
+// when every dial happened
+type failingDials struct {
+	*PipeTransport
+	fail  map[int]bool
+	mu    sync.Mutex
+	dials []time.Time
+}
+
+func (t *failingDials) Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (Conn, error) {
+	t.mu.Lock()
+	n := len(t.dials)
+	t.dials = append(t.dials, time.Now())
+	t.mu.Unlock()
+	if t.fail[n] {
+		return nil, errors.New("connection refused")
+	}
+	return t.PipeTransport.Dial(ctx, u, header, subprotocols)
+}
+
+func TestReconnectResumes(t *testing.T) {
+	transport := &failingDials{PipeTransport: NewPipeTransport("roader.gob"), fail: map[int]bool{1: true, 2: true}}
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 0
+	gs.Backoff = Backoff{Min: 20 * time.Millisecond, Max: time.Second, Factor: 2}
+	states := gs.Subscribe()
+
+	send := func(c *PipeConn, sm model.ServerMessage) {
+		var frame bytes.Buffer
+		GobCodec{}.Encode(&frame, sm)
+		c.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+	}
+	open := []bool{false, false, false, false}
+	resumed := make(chan url.URL, 1)
+	drop := make(chan struct{})
+	go func() {
+		first := <-transport.Accept()
+		send(first, model.ServerMessage{
+			Setup: []model.Setup{{Cols: 3, Rows: 2, PlayerKey: 'A',
+				Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 1}}}},
+			Visibles: []model.Visibilize{
+				{Col: 1, Row: 1, Walls: open, Locks: open, HasPlayer: true, PlayerId: 'A'},
+				{Col: 2, Row: 1, Walls: open, Locks: open, Diamond: true},
+			},
+		})
+		<-drop
+		first.Close()
+
+		second := <-transport.Accept()
+		resumed <- second.URL
+		// the player moved meanwhile and picked a key
+		send(second, model.ServerMessage{Setup: []model.Setup{{Cols: 3, Rows: 2, PlayerKey: 'A',
+			Players: map[int32]model.Player{'A': {Id: 'A', Col: 0, Row: 0, Keys: 1}}}}})
+		<-gs.Done()
+	}()
+
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for gs.Model == nil && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Model == nil || !gs.Known(2, 1) {
+		t.Fatal("first Setup not applied")
+	}
+	m, player := gs.Model, gs.Model.Players['A']
+	close(drop)
+
+	select {
+	case u := <-resumed:
+		if u.Query().Get("player") != strconv.Itoa('A') {
+			t.Errorf("redialed %s without player key", u.String())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no redial")
+	}
+	for player.Col != 0 && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	if gs.Model != m || gs.Model.Players['A'] != player {
+		t.Fatal("resumed Setup rebuilt the model")
+	}
+	if player.Col != 0 || player.Row != 0 || player.Keys != 1 {
+		t.Errorf("player not synced, at %d,%d with %d keys", player.Col, player.Row, player.Keys)
+	}
+	if m.Matrix[1][1].Player != nil || m.Matrix[0][0].Player != player {
+		t.Error("player not moved on the board")
+	}
+	if !gs.Known(1, 1) || !gs.Known(2, 1) || !m.Matrix[2][1].Diamond {
+		t.Error("discovered cells forgotten")
+	}
+
+	// attempts count up while dials fail, waits between them grow
+	var attempts []int
+collect:
+	for {
+		select {
+		case e := <-states:
+			if e.State == CS_RECONNECTING {
+				attempts = append(attempts, e.Attempt)
+			}
+		default:
+			break collect
+		}
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("reconnect attempts %v", attempts)
+	}
+	transport.mu.Lock()
+	dials := transport.dials
+	transport.mu.Unlock()
+	if len(dials) != 4 {
+		t.Fatalf("%d dials", len(dials))
+	}
+	for i, want := range []time.Duration{40 * time.Millisecond, 80 * time.Millisecond} {
+		if wait := dials[i+2].Sub(dials[i+1]); wait < want {
+			t.Errorf("dial %d after %v, want at least %v", i+2, wait, want)
+		}
+	}
+}
+
+func TestRefusedResumeRetries(t *testing.T) {
+	transport := NewPipeTransport("roader.gob")
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 0
+	gs.Backoff = Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1}
+	states := gs.Subscribe()
+
+	setup := model.ServerMessage{Setup: []model.Setup{{Cols: 3, Rows: 2, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 1, Row: 1}}}}}
+	refuse := func(c *PipeConn, reason string) {
+		c.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), time.Now().Add(time.Second))
+		c.Close()
+	}
+	drop := make(chan struct{})
+	go func() {
+		var frame bytes.Buffer
+		GobCodec{}.Encode(&frame, setup)
+		first := <-transport.Accept()
+		first.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+		<-drop
+		first.Close()
+		// server still holds the dropped connection
+		refuse(<-transport.Accept(), "player not available")
+		third := <-transport.Accept()
+		third.WriteMessage(websocket.BinaryMessage, frame.Bytes())
+		// resumed player kicked out after Setup is rejected for good
+		refuse(third, "kicked")
+	}()
+
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+	deadline := time.Now().Add(time.Second)
+	for gs.Model == nil && time.Now().Before(deadline) {
+		gs.Loop()
+		time.Sleep(time.Millisecond)
+	}
+	close(drop)
+	var errs []error
+	for {
+		gs.Loop()
+		select {
+		case e := <-states:
+			if e.State == CS_RECONNECTING {
+				errs = append(errs, e.Err)
+			}
+			if e.State != CS_CLOSED {
+				continue
+			}
+			if ErrorKindOf(e.Err) != ERR_REJECTED {
+				t.Errorf("session ended with %v", e.Err)
+			}
+			if len(errs) != 2 || ErrorKindOf(errs[1]) != ERR_CLOSED {
+				t.Errorf("reconnected after %v", errs)
+			}
+			return
+		case <-time.After(time.Millisecond):
+			if time.Now().After(deadline.Add(time.Second)) {
+				t.Fatalf("session not ended, reconnected after %v", errs)
+			}
+		}
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	transport := NewPipeTransport("roader.gob")
+	gs := NewGameSession(DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat = Heartbeat{Interval: 10 * time.Millisecond, Timeout: 20 * time.Millisecond}
+	gs.Backoff = Backoff{Min: time.Second, Max: time.Second, Factor: 1}
+	states := gs.Subscribe()
+	accepted := make(chan *PipeConn, 1)
+	// server never reads, so pings are never answered
+	go func() { accepted <- <-transport.Accept() }()
+	if err := gs.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+	server := <-accepted
+
+	for {
+		select {
+		case e := <-states:
+			if e.State != CS_RECONNECTING {
+				continue
+			}
+			if ErrorKindOf(e.Err) != ERR_TIMEOUT {
+				t.Errorf("reconnecting after %v", e.Err)
+			}
+			if err := server.WriteMessage(websocket.BinaryMessage, nil); err == nil {
+				t.Error("timed out connection still open")
+			}
+			return
+		case <-time.After(time.Second):
+			t.Fatalf("no timeout, state %s", gs.State().Name())
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"sort"
+	"time"
+)
+
+// PlaybackSpeeds are the speeds Faster and Slower step through
+var PlaybackSpeeds = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+// Playback feeds recorded ServerMessages into GameSession.MessagesIn in place
+// of the connection, Loop applies them to Model as usual. Chat goes straight
+// to GameSession.Chat, sent messages in the replay are skipped.
+type Playback struct {
+	Header  ReplayHeader
+	Entries []ReplayEntry
+	Paused  bool
+	// Speed multiplies time passed to Advance, one of PlaybackSpeeds
+	Speed float64
+
+	gs *GameSession
+	// pos is the replay clock, next is index of first entry not fed yet
+	pos  time.Duration
+	next int
+}
+
+func NewPlayback(gs *GameSession, header ReplayHeader, entries []ReplayEntry) *Playback {
+	// seeking may queue the whole replay at once
+	gs.MessagesIn.Limits = InboundLimits{}
+	return &Playback{Header: header, Entries: entries, Speed: 1, gs: gs}
+}
+
+// Advance moves replay clock by real time passed since last frame
+func (pb *Playback) Advance(dt time.Duration) {
+	if pb.Paused || pb.Ended() {
+		return
+	}
+	pb.pos += time.Duration(float64(dt) * pb.Speed)
+	pb.feed()
+}
+
+// Step pauses playback and feeds exactly one more received message
+func (pb *Playback) Step() {
+	pb.Paused = true
+	for pb.next < len(pb.Entries) {
+		e := pb.Entries[pb.next]
+		pb.next++
+		pb.extras(e)
+		if e.In != nil {
+			pb.pos = e.At
+			pb.gs.MessagesIn.Push(*e.In)
+			return
+		}
+	}
+}
+
+// Seek moves replay clock to t. Going back rebuilds Model from the start
+// since messages can't be unapplied.
+func (pb *Playback) Seek(t time.Duration) {
+	if t < 0 {
+		t = 0
+	}
+	if t > pb.Duration() {
+		t = pb.Duration()
+	}
+	if t < pb.pos {
+		pb.gs.MessagesIn.Reset()
+		pb.gs.Chat.Reset()
+		pb.gs.Model = nil
+		pb.gs.PlayerKey = 0
+		pb.next = 0
+	}
+	pb.pos = t
+	pb.feed()
+}
+
+func (pb *Playback) feed() {
+	end := sort.Search(len(pb.Entries), func(i int) bool { return pb.Entries[i].At > pb.pos })
+	for ; pb.next < end; pb.next++ {
+		e := pb.Entries[pb.next]
+		if e.In != nil {
+			pb.gs.MessagesIn.Push(*e.In)
+		}
+		pb.extras(e)
+	}
+}
+
+// extras replays what is not applied by Loop
+func (pb *Playback) extras(e ReplayEntry) {
+	if e.Chat != nil {
+		pb.gs.Chat.Add(*e.Chat)
+	}
+	if e.Names != nil {
+		pb.gs.setNames(e.Names)
+	}
+}
+
+func (pb *Playback) Faster() {
+	pb.Speed = stepSpeed(pb.Speed, 1)
+}
+
+func (pb *Playback) Slower() {
+	pb.Speed = stepSpeed(pb.Speed, -1)
+}
+
+func stepSpeed(speed float64, by int) float64 {
+	i := sort.SearchFloat64s(PlaybackSpeeds, speed) + by
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(PlaybackSpeeds) {
+		i = len(PlaybackSpeeds) - 1
+	}
+	return PlaybackSpeeds[i]
+}
+
+func (pb *Playback) Position() time.Duration {
+	return pb.pos
+}
+
+func (pb *Playback) Duration() time.Duration {
+	if len(pb.Entries) == 0 {
+		return 0
+	}
+	return pb.Entries[len(pb.Entries)-1].At
+}
+
+func (pb *Playback) Ended() bool {
+	return pb.next >= len(pb.Entries)
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"testing"
+	"time"
+)
+
+func TestPlaybackSeek(t *testing.T) {
+	setup := model.ServerMessage{Setup: []model.Setup{{
+		Cols: 3, Rows: 2, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 0, Row: 0}}}}}
+	right := func(col int) *model.ServerMessage {
+		return &model.ServerMessage{Directions: []model.DirectionSuccess{{
+			Direction: 0, Col: col, Row: 0, Success: true, PlayerKey: 'A'}}}
+	}
+	entries := []ReplayEntry{
+		{At: 0, In: &setup},
+		{At: time.Second, Out: &model.ClientMessage{Move: 0}},
+		{At: 2 * time.Second, In: right(1)},
+		{At: 4 * time.Second, In: right(2)},
+	}
+	gs := NewGameSession(DefaultConfig())
+	pb := NewPlayback(gs, ReplayHeader{}, entries)
+	col := func() int {
+		gs.Loop()
+		if gs.Model == nil {
+			return -1
+		}
+		return gs.Model.Players['A'].Col
+	}
+
+	pb.Advance(0)
+	if c := col(); c != 0 {
+		t.Fatalf("after setup at col %d", c)
+	}
+	pb.Speed = 2
+	pb.Advance(time.Second)
+	if c := col(); c != 1 {
+		t.Errorf("at 2x after 1s col %d", c)
+	}
+	pb.Seek(time.Hour)
+	if c := col(); c != 2 || !pb.Ended() || pb.Position() != pb.Duration() {
+		t.Errorf("seek to end col %d at %v", c, pb.Position())
+	}
+	pb.Seek(time.Second)
+	if c := col(); c != 0 {
+		t.Errorf("seek back col %d", c)
+	}
+	pb.Step()
+	if c := col(); c != 1 || !pb.Paused || pb.Position() != 2*time.Second {
+		t.Errorf("step col %d at %v", c, pb.Position())
+	}
+	pb.Advance(time.Hour)
+	if c := col(); c != 1 {
+		t.Errorf("paused playback moved to col %d", c)
+	}
+	pb.Faster()
+	pb.Faster()
+	if pb.Speed != 8 {
+		t.Errorf("speed %v", pb.Speed)
+	}
+}
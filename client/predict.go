@@ -0,0 +1,184 @@
+package client
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roader/model"
+)
+
+// prediction is own move applied to Model before the server answered it,
+// with everything it changed so it can be rolled back
+type prediction struct {
+	Seq  uint32
+	Move int
+	// applied is false when the move looked impossible locally, it still
+	// waits for its reply to keep replies matched
+	applied bool
+	player  model.Player
+	cells   []cellState
+	paths   []pathState
+}
+
+type cellState struct {
+	cell         *model.Cell
+	player       *model.Player
+	diamond, key bool
+	crossing     bool
+}
+
+type pathState struct {
+	path   *model.Path
+	player *model.Player
+	wall   bool
+}
+
+// Move sends own move and, with Config.Predict, applies it to Model right
+// away. The server processes moves of a player in order and answers each
+// with one DirectionSuccess, so replies are matched to predictions by their
+// sequence. Called from the game loop goroutine like Loop.
+// Manual move ends travel started by Travel. Move never blocks, it is
+// dropped when the outbound queue is full, e.g. while reconnecting.
+func (gs *GameSession) Move(d int) {
+	gs.travel = nil
+	select {
+	case gs.MessagesOut <- model.ClientMessage{Move: d}:
+		gs.unanswered++
+		gs.predictMove(d)
+	default:
+		log.Warnf("GameSession.Move outbound queue full, move %d dropped", d)
+	}
+}
+
+// predictMove records sent move to match its reply
+func (gs *GameSession) predictMove(d int) {
+	if gs.Config.Predict && !gs.Spectating() && gs.Model != nil {
+		gs.seq++
+		p := &prediction{Seq: gs.seq, Move: d}
+		gs.predict(p)
+		gs.predictions = append(gs.predictions, p)
+	}
+}
+
+// Predicted is number of own moves waiting for server reply
+func (gs *GameSession) Predicted() int {
+	return len(gs.predictions)
+}
+
+// predict applies p when the known board allows it, mirroring server rules
+func (gs *GameSession) predict(p *prediction) {
+	p.applied, p.cells, p.paths = false, nil, nil
+	player := gs.Model.Players[gs.PlayerKey]
+	if player == nil {
+		return
+	}
+	cell := gs.Model.Matrix[player.Col][player.Row]
+	var target *model.Cell
+	var path *model.Path
+	switch {
+	case p.Move == 4:
+		if cell.Portal == nil {
+			return
+		}
+		target = cell.Portal.Target
+	case p.Move >= 0 && p.Move < 4:
+		path = cell.Paths[p.Move]
+		target = path.Target
+		if target == nil || path.Wall && !(path.Lock && player.Keys > 0) {
+			return
+		}
+	default:
+		return
+	}
+	if target.Player != nil {
+		return
+	}
+
+	p.applied = true
+	p.player = *player
+	p.cells = append(p.cells, saveCell(cell), saveCell(target))
+	if path != nil {
+		back := target.Paths[(p.Move+2)%4]
+		p.paths = append(p.paths, savePath(path), savePath(back))
+		if path.Wall {
+			player.Keys--
+		}
+		path.Wall, back.Wall = false, false
+		path.Player, back.Player = player, player
+	}
+	if target.Diamond {
+		player.Diamonds++
+	}
+	if target.Key {
+		player.Keys++
+	}
+	target.Diamond, target.Key = false, false
+	cell.Player = nil
+	target.Player = player
+	player.Col, player.Row = target.Col, target.Row
+	cell.Crossings()
+	target.Crossings()
+}
+
+func saveCell(c *model.Cell) cellState {
+	return cellState{cell: c, player: c.Player, diamond: c.Diamond, key: c.Key, crossing: c.Crossing}
+}
+
+func savePath(p *model.Path) pathState {
+	return pathState{path: p, player: p.Player, wall: p.Wall}
+}
+
+func (p *prediction) undo(m *model.Model) {
+	if !p.applied {
+		return
+	}
+	for i := len(p.paths) - 1; i >= 0; i-- {
+		s := p.paths[i]
+		s.path.Player, s.path.Wall = s.player, s.wall
+	}
+	for i := len(p.cells) - 1; i >= 0; i-- {
+		s := p.cells[i]
+		s.cell.Player, s.cell.Diamond, s.cell.Key, s.cell.Crossing = s.player, s.diamond, s.key, s.crossing
+	}
+	*m.Players[p.player.Id] = p.player
+}
+
+// rollback returns Model to what the server confirmed so far, predictions
+// keep whether they were applied until replay
+func (gs *GameSession) rollback() {
+	for i := len(gs.predictions) - 1; i >= 0; i-- {
+		gs.predictions[i].undo(gs.Model)
+	}
+}
+
+// replay applies moves still waiting for reply on top of confirmed Model,
+// a move the new state makes impossible stays unapplied
+func (gs *GameSession) replay() {
+	for _, p := range gs.predictions {
+		gs.predict(p)
+	}
+}
+
+// own tells reply to our move. Servers not setting PlayerKey of failed moves
+// are handled too, only the mover gets failures.
+func (gs *GameSession) own(ds model.DirectionSuccess) bool {
+	return ds.PlayerKey == gs.PlayerKey || ds.PlayerKey == 0 && !ds.Success
+}
+
+// acknowledge takes own DirectionSuccess as reply to the oldest unanswered
+// move and drops its prediction
+func (gs *GameSession) acknowledge(ds model.DirectionSuccess) {
+	if !gs.own(ds) {
+		return
+	}
+	if gs.unanswered > 0 {
+		gs.unanswered--
+	}
+	if len(gs.predictions) == 0 {
+		return
+	}
+	p := gs.predictions[0]
+	gs.predictions[0] = nil
+	gs.predictions = gs.predictions[1:]
+	if p.applied != ds.Success {
+		gs.Mispredicted++
+	}
+}
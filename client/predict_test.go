@@ -0,0 +1,89 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"testing"
+	"time"
+)
+
+func TestPredictMoves(t *testing.T) {
+	gs := NewGameSession(DefaultConfig())
+	gs.apply(model.ServerMessage{
+		Setup: []model.Setup{{
+			Cols: 3, Rows: 1, PlayerKey: 'A',
+			Players: map[int32]model.Player{
+				'A': {Id: 'A', Col: 0, Row: 0},
+				'B': {Id: 'B', Col: 2, Row: 0}}}},
+		Visibles: []model.Visibilize{{Col: 1, Row: 0, Diamond: true,
+			Walls: []bool{true, true, false, true}, Locks: make([]bool, 4)}},
+	})
+	player := gs.Model.Players['A']
+	reply := func(pk int32, col int, success bool) {
+		gs.apply(model.ServerMessage{Directions: []model.DirectionSuccess{{
+			Direction: 0, Col: col, Row: 0, Success: success, PlayerKey: pk}}})
+	}
+
+	gs.Move(0)
+	if player.Col != 1 || player.Diamonds != 1 || gs.Model.Matrix[1][0].Diamond {
+		t.Fatalf("predicted move at col %d diamonds %d", player.Col, player.Diamonds)
+	}
+	gs.Move(0)
+	if player.Col != 1 || gs.Predicted() != 2 {
+		t.Fatalf("move into wall predicted, col %d pending %d", player.Col, gs.Predicted())
+	}
+
+	// other player's reply keeps predictions in place
+	reply('B', 2, false)
+	if player.Col != 1 || gs.Predicted() != 2 {
+		t.Errorf("after other player col %d pending %d", player.Col, gs.Predicted())
+	}
+
+	reply('A', 1, true)
+	if player.Col != 1 || gs.Predicted() != 1 || gs.Mispredicted != 0 {
+		t.Errorf("confirmed col %d pending %d mispredicted %d", player.Col, gs.Predicted(), gs.Mispredicted)
+	}
+	reply(0, 1, false)
+	if player.Col != 1 || gs.Predicted() != 0 || gs.Mispredicted != 0 {
+		t.Errorf("rejected col %d pending %d mispredicted %d", player.Col, gs.Predicted(), gs.Mispredicted)
+	}
+	if r := gs.Rejected(); len(r) != 1 || r[0].Reason != REJECT_WALL || r[0].Col != 1 {
+		t.Errorf("rejected %v", r)
+	}
+
+	// server rejects predicted move, board goes back to confirmed state
+	gs.Move(2)
+	if player.Col != 0 || gs.Model.Matrix[1][0].Player != nil {
+		t.Fatalf("predicted move back at col %d", player.Col)
+	}
+	reply('A', 1, false)
+	if player.Col != 1 || gs.Model.Matrix[0][0].Player != nil || gs.Model.Matrix[1][0].Player != player ||
+		gs.Model.Matrix[1][0].Paths[2].Player != player {
+		t.Errorf("rollback left player at col %d", player.Col)
+	}
+	if gs.Mispredicted != 1 || gs.Predicted() != 0 {
+		t.Errorf("mispredicted %d pending %d", gs.Mispredicted, gs.Predicted())
+	}
+}
+
+func TestMoveWithFullQueue(t *testing.T) {
+	gs := NewGameSession(DefaultConfig())
+	gs.apply(model.ServerMessage{Setup: []model.Setup{{Cols: 3, Rows: 1, PlayerKey: 'A',
+		Players: map[int32]model.Player{'A': {Id: 'A', Col: 0, Row: 0}}}}})
+	// nobody drains MessagesOut, like while reconnecting
+	for i := 0; i < cap(gs.MessagesOut); i++ {
+		gs.MessagesOut <- model.ClientMessage{Move: 1}
+	}
+	moved := make(chan struct{})
+	go func() {
+		gs.Move(0)
+		close(moved)
+	}()
+	select {
+	case <-moved:
+	case <-time.After(time.Second):
+		t.Fatal("Move blocks on full queue")
+	}
+	if gs.Predicted() != 0 || gs.unanswered != 0 || gs.Model.Players['A'].Col != 0 {
+		t.Errorf("dropped move predicted %d, unanswered %d", gs.Predicted(), gs.unanswered)
+	}
+}
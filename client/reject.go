@@ -0,0 +1,95 @@
+package client
+
+import (
+	"fmt"
+	"github.com/zucenko/roader/model"
+)
+
+// RejectReason tells why the server refused own move, as far as the known
+// board can explain it
+type RejectReason int
+
+const (
+	REJECT_UNKNOWN RejectReason = iota
+	// REJECT_EDGE is move out of the board
+	REJECT_EDGE
+	REJECT_WALL
+	// REJECT_LOCK is lock the player has no key for
+	REJECT_LOCK
+	// REJECT_PLAYER is target cell taken by another player
+	REJECT_PLAYER
+	// REJECT_PORTAL is portal move from cell without portal
+	REJECT_PORTAL
+)
+
+func (r RejectReason) Name() string {
+	switch r {
+	case REJECT_UNKNOWN:
+		return "UNKNOWN"
+	case REJECT_EDGE:
+		return "EDGE"
+	case REJECT_WALL:
+		return "WALL"
+	case REJECT_LOCK:
+		return "LOCK"
+	case REJECT_PLAYER:
+		return "PLAYER"
+	case REJECT_PORTAL:
+		return "PORTAL"
+	default:
+		return fmt.Sprintf("N/A(%d)", r)
+	}
+}
+
+// Reject is own move refused by the server
+type Reject struct {
+	Move int
+	// Col and Row is where the player stood
+	Col, Row int
+	Reason   RejectReason
+}
+
+// rejectsKept bounds rejects nobody takes
+const rejectsKept = 16
+
+// Rejected returns moves refused since the last call, oldest first.
+// Called from the game loop goroutine like Loop.
+func (gs *GameSession) Rejected() []Reject {
+	r := gs.rejects
+	gs.rejects = nil
+	return r
+}
+
+// reject explains refused move against confirmed Model
+func (gs *GameSession) reject(ds model.DirectionSuccess) {
+	player := gs.Model.Players[gs.PlayerKey]
+	if player == nil {
+		return
+	}
+	r := Reject{Move: ds.Direction, Col: player.Col, Row: player.Row}
+	cell := gs.Model.Matrix[player.Col][player.Row]
+	switch {
+	case ds.Direction == 4 && cell.Portal == nil:
+		r.Reason = REJECT_PORTAL
+	case ds.Direction == 4:
+		if cell.Portal.Target.Player != nil {
+			r.Reason = REJECT_PLAYER
+		}
+	case ds.Direction >= 0 && ds.Direction < 4:
+		path := cell.Paths[ds.Direction]
+		switch {
+		case path.Target == nil:
+			r.Reason = REJECT_EDGE
+		case path.Wall && path.Lock && player.Keys == 0:
+			r.Reason = REJECT_LOCK
+		case path.Wall && !path.Lock:
+			r.Reason = REJECT_WALL
+		case path.Target.Player != nil:
+			r.Reason = REJECT_PLAYER
+		}
+	}
+	if len(gs.rejects) == rejectsKept {
+		gs.rejects = gs.rejects[1:]
+	}
+	gs.rejects = append(gs.rejects, r)
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"testing"
+)
+
+func TestRejectReasons(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Predict = false
+	gs := NewGameSession(cfg)
+	gs.apply(model.ServerMessage{
+		Setup: []model.Setup{{
+			Cols: 3, Rows: 2, PlayerKey: 'A',
+			Players: map[int32]model.Player{
+				'A': {Id: 'A', Col: 1, Row: 0},
+				'B': {Id: 'B', Col: 2, Row: 0}}}},
+		Visibles: []model.Visibilize{{Col: 1, Row: 0,
+			Walls: []bool{false, true, true, true}, Locks: []bool{false, true, false, false}}},
+	})
+	for move, reason := range []RejectReason{REJECT_PLAYER, REJECT_LOCK, REJECT_WALL, REJECT_EDGE, REJECT_PORTAL} {
+		gs.apply(model.ServerMessage{Directions: []model.DirectionSuccess{{Direction: move}}})
+		r := gs.Rejected()
+		if len(r) != 1 || r[0].Move != move || r[0].Reason != reason || r[0].Col != 1 || r[0].Row != 0 {
+			t.Errorf("move %d rejected %v, expected %s", move, r, reason.Name())
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roader/model"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReplayMagic starts every replay file, the rest is gzipped gob stream of
+// ReplayHeader followed by ReplayEntries
+const ReplayMagic = "ROADRPL1"
+
+const ReplayExt = ".rpl"
+
+// replayFlushInterval bounds what is lost when the client crashes
+const replayFlushInterval = time.Second
+
+type ReplayHeader struct {
+	Started  time.Time
+	Host     string
+	Player   string
+	Spectate bool
+}
+
+// ReplayEntry is one message, exactly one of In, Out, Chat and Names is set
+type ReplayEntry struct {
+	// At is time since recording started
+	At    time.Duration
+	In    *model.ServerMessage
+	Out   *model.ClientMessage
+	Chat  *ChatMessage
+	Names map[int32]string
+}
+
+// Recorder writes every message passing GameSession into a replay.
+// It is safe for concurrent use; after the first write error it stops
+// recording and keeps the error, the session is never disturbed.
+type Recorder struct {
+	mu      sync.Mutex
+	started time.Time
+	flushed time.Time
+	closer  io.Closer
+	buf     *bufio.Writer
+	zip     *gzip.Writer
+	enc     *gob.Encoder
+	err     error
+	closed  bool
+}
+
+func NewRecorder(w io.Writer, header ReplayHeader) (*Recorder, error) {
+	if header.Started.IsZero() {
+		header.Started = time.Now()
+	}
+	rec := &Recorder{started: header.Started, flushed: time.Now(), buf: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		rec.closer = c
+	}
+	if _, err := rec.buf.WriteString(ReplayMagic); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	rec.zip = gzip.NewWriter(rec.buf)
+	rec.enc = gob.NewEncoder(rec.zip)
+	if err := rec.enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("replay header: %w", err)
+	}
+	return rec, nil
+}
+
+// CreateReplay starts recording into new timestamped file in dir, sessions
+// started within the same second get numbered suffix
+func CreateReplay(dir string, cfg Config) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("replay dir: %w", err)
+	}
+	now := time.Now()
+	base := filepath.Join(dir, "roader-"+now.Format("20060102-150405"))
+	name := base + ReplayExt
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	for i := 2; os.IsExist(err); i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ReplayExt)
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	rec, err := NewRecorder(f, ReplayHeader{Started: now, Host: cfg.Host, Player: cfg.Player, Spectate: cfg.Spectate})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (rec *Recorder) Received(sm model.ServerMessage) {
+	rec.record(ReplayEntry{In: &sm})
+}
+
+func (rec *Recorder) Sent(cm model.ClientMessage) {
+	rec.record(ReplayEntry{Out: &cm})
+}
+
+func (rec *Recorder) Chatted(m ChatMessage) {
+	rec.record(ReplayEntry{Chat: &m})
+}
+
+func (rec *Recorder) Named(names map[int32]string) {
+	rec.record(ReplayEntry{Names: names})
+}
+
+func (rec *Recorder) record(e ReplayEntry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err != nil || rec.closed {
+		return
+	}
+	e.At = time.Since(rec.started)
+	if err := rec.enc.Encode(e); err != nil {
+		rec.err = fmt.Errorf("replay: %w", err)
+		return
+	}
+	if time.Since(rec.flushed) >= replayFlushInterval {
+		rec.flush()
+	}
+}
+
+// Flush pushes recorded entries to the file so it is readable even if the
+// client dies later
+func (rec *Recorder) Flush() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err != nil || rec.closed {
+		return rec.err
+	}
+	return rec.flush()
+}
+
+func (rec *Recorder) flush() error {
+	rec.flushed = time.Now()
+	if err := rec.zip.Flush(); err != nil {
+		rec.err = fmt.Errorf("replay: %w", err)
+		return rec.err
+	}
+	if err := rec.buf.Flush(); err != nil {
+		rec.err = fmt.Errorf("replay: %w", err)
+	}
+	return rec.err
+}
+
+func (rec *Recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// Close finishes the replay and closes underlying writer if it is io.Closer,
+// calling it again does nothing
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.closed {
+		return rec.err
+	}
+	rec.closed = true
+	err := rec.err
+	if err == nil {
+		err = rec.zip.Close()
+	}
+	if err == nil {
+		err = rec.buf.Flush()
+	}
+	if rec.closer != nil {
+		if cerr := rec.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ReplayReader reads entries of replay written by Recorder
+type ReplayReader struct {
+	Header ReplayHeader
+	zip    *gzip.Reader
+	dec    *gob.Decoder
+}
+
+func NewReplayReader(r io.Reader) (*ReplayReader, error) {
+	magic := make([]byte, len(ReplayMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	if string(magic) != ReplayMagic {
+		return nil, fmt.Errorf("replay: not a replay file")
+	}
+	zip, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	rr := &ReplayReader{zip: zip, dec: gob.NewDecoder(zip)}
+	if err := rr.dec.Decode(&rr.Header); err != nil {
+		return nil, fmt.Errorf("replay header: %w", err)
+	}
+	return rr, nil
+}
+
+// Next returns io.EOF after the last entry. Replay of client which died
+// mid-session ends with io.ErrUnexpectedEOF after the last flushed entry.
+func (rr *ReplayReader) Next() (ReplayEntry, error) {
+	e := ReplayEntry{}
+	err := rr.dec.Decode(&e)
+	return e, err
+}
+
+// ReadReplay loads whole replay file, truncated tail is ignored
+func ReadReplay(path string) (ReplayHeader, []ReplayEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ReplayHeader{}, nil, fmt.Errorf("replay: %w", err)
+	}
+	defer f.Close()
+	rr, err := NewReplayReader(bufio.NewReader(f))
+	if err != nil {
+		return ReplayHeader{}, nil, err
+	}
+	var entries []ReplayEntry
+	for {
+		e, err := rr.Next()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return rr.Header, entries, nil
+		}
+		if err != nil {
+			return rr.Header, entries, fmt.Errorf("replay: %w", err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+func (gs *GameSession) closeRecorder() {
+	if gs.Recorder == nil {
+		return
+	}
+	if err := gs.Recorder.Close(); err != nil {
+		log.Warnf("GameSession recorder %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"bytes"
+	"github.com/zucenko/roader/model"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplayRoundTrip(t *testing.T) {
+	var file bytes.Buffer
+	rec, err := NewRecorder(&file, ReplayHeader{Host: "localhost:8080", Player: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Received(model.ServerMessage{Picks: []model.Pick{{Keys: 1, Diamonds: 2}}})
+	rec.Sent(model.ClientMessage{Move: 3})
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err := NewReplayReader(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Header.Host != "localhost:8080" || rr.Header.Player != "A" {
+		t.Errorf("header %+v", rr.Header)
+	}
+	in, err := rr.Next()
+	if err != nil || in.In == nil || in.Out != nil || in.In.Picks[0].Diamonds != 2 {
+		t.Fatalf("first entry %+v %v", in, err)
+	}
+	out, err := rr.Next()
+	if err != nil || out.Out == nil || out.Out.Move != 3 || out.At < in.At {
+		t.Fatalf("second entry %+v %v", out, err)
+	}
+	if _, err := rr.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReplayFlushedTailReadable(t *testing.T) {
+	var file bytes.Buffer
+	rec, _ := NewRecorder(&file, ReplayHeader{})
+	rec.Sent(model.ClientMessage{Move: 1})
+	if err := rec.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// client died here, Close never happened
+	rr, err := NewReplayReader(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := rr.Next(); err != nil || e.Out.Move != 1 {
+		t.Fatalf("entry %+v %v", e, err)
+	}
+	if _, err := rr.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestCreateReplaySameSecond(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roader-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// within one second names collide at least once
+	for i := 0; i < 3; i++ {
+		rec, err := CreateReplay(dir, DefaultConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+ReplayExt))
+	if err != nil || len(files) != 3 {
+		t.Fatalf("replays %v %v", files, err)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewReplayReader(f); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"sort"
+)
+
+// Spectating session controls no player, PlayerKey stays 0 and Picks are
+// never sent, inventories are counted from moves over the fully visible board
+func (gs *GameSession) Spectating() bool {
+	return gs.Config.Spectate
+}
+
+// collect counts what player picked up entering cell and empties the cell
+func (gs *GameSession) collect(player *model.Player, cell *model.Cell) {
+	if cell.Diamond {
+		player.Diamonds++
+	}
+	if cell.Key {
+		player.Keys++
+	}
+	cell.Diamond = false
+	cell.Key = false
+}
+
+// PlayerOrder lists player keys of Model in stable order for cycling focus
+func (gs *GameSession) PlayerOrder() []int32 {
+	if gs.Model == nil {
+		return nil
+	}
+	keys := make([]int32, 0, len(gs.Model.Players))
+	for key := range gs.Model.Players {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
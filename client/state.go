@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+type ConnState int
+
+const (
+	CS_CONNECTING ConnState = iota + 1
+	CS_CONNECTED
+	CS_RECONNECTING
+	CS_CLOSED
+)
+
+func (s ConnState) Name() string {
+	switch s {
+	case CS_CONNECTING:
+		return "CONNECTING"
+	case CS_CONNECTED:
+		return "CONNECTED"
+	case CS_RECONNECTING:
+		return "RECONNECTING"
+	case CS_CLOSED:
+		return "CLOSED"
+	default:
+		return fmt.Sprintf("N/A(%d)", s)
+	}
+}
+
+// StateEvent is sent to subscribers on every connection state change.
+type StateEvent struct {
+	State ConnState
+	// Err caused the change, nil for planned changes
+	Err error
+	// Attempt is reconnect attempt number while CS_RECONNECTING
+	Attempt int
+}
+
+// Subscribe returns channel receiving connection state changes. Slow subscriber
+// loses oldest events, State always tells the current one.
+func (gs *GameSession) Subscribe() <-chan StateEvent {
+	ch := make(chan StateEvent, 8)
+	gs.mu.Lock()
+	gs.subscribers = append(gs.subscribers, ch)
+	gs.mu.Unlock()
+	return ch
+}
+
+func (gs *GameSession) State() ConnState {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return gs.state
+}
+
+func (gs *GameSession) setState(e StateEvent) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.state = e.State
+	if e.State == CS_CONNECTED {
+		gs.err = nil
+	} else if e.Err != nil {
+		gs.err = e.Err
+	}
+	log.Printf("GameSession state %s %v", e.State.Name(), e.Err)
+	for _, ch := range gs.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Warnf("GameSession state subscriber full, dropping oldest")
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- e
+		}
+	}
+}
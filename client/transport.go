@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Transport opens connections of GameSession. WebsocketTransport talks to real
+// server, PipeTransport to in-process one.
+type Transport interface {
+	// Dial sends header with the handshake request
+	Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (Conn, error)
+}
+
+// Conn is one connection, the subset of *websocket.Conn GameSession uses.
+// Close and WriteControl may be called concurrently with other methods.
+type Conn interface {
+	NextReader() (messageType int, r io.Reader, err error)
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Subprotocol() string
+	Close() error
+}
+
+// ErrRefused is handshake the server answered with 401 or 403
+var ErrRefused = errors.New("handshake refused")
+
+type WebsocketTransport struct {
+	Dialer *websocket.Dialer
+}
+
+func NewWebsocketTransport(cfg Config) (*WebsocketTransport, error) {
+	dialer := *websocket.DefaultDialer
+	if cfg.Scheme == "wss" {
+		tc, err := cfg.TLS.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLSClientConfig = tc
+	}
+	return &WebsocketTransport{Dialer: &dialer}, nil
+}
+
+func (t *WebsocketTransport) Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (Conn, error) {
+	dialer := *t.Dialer
+	dialer.Subprotocols = subprotocols
+	c, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return nil, fmt.Errorf("%w: %s", ErrRefused, resp.Status)
+		}
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// upgradeAndClose accepts websocket and hangs up
+var upgradeAndClose = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err == nil {
+		c.Close()
+	}
+})
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dialTLS opens websocket to test server over TLS configured by tc
+func dialTLS(hs *httptest.Server, tc TLSConfig) error {
+	cfg := DefaultConfig()
+	cfg.Scheme, cfg.TLS = "wss", tc
+	transport, err := NewWebsocketTransport(cfg)
+	if err != nil {
+		return err
+	}
+	u, _ := url.Parse(hs.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c, err := transport.Dial(ctx, url.URL{Scheme: "wss", Host: u.Host, Path: "/play"}, nil, nil)
+	if err == nil {
+		c.Close()
+	}
+	return err
+}
+
+func TestTLSServerVerification(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roader-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hs := httptest.NewTLSServer(upgradeAndClose)
+	defer hs.Close()
+	// test certificate is issued for 127.0.0.1 and example.com
+	ca := filepath.Join(dir, "ca.pem")
+	writePEM(t, ca, "CERTIFICATE", hs.Certificate().Raw)
+
+	for _, c := range []struct {
+		name string
+		tls  TLSConfig
+		ok   bool
+	}{
+		{"trusted ca", TLSConfig{CAFile: ca}, true},
+		{"system roots", TLSConfig{}, false},
+		{"insecure", TLSConfig{Insecure: true}, true},
+		{"server name", TLSConfig{CAFile: ca, ServerName: "example.com"}, true},
+		{"wrong server name", TLSConfig{CAFile: ca, ServerName: "roader.test"}, false},
+	} {
+		if err := dialTLS(hs, c.tls); (err == nil) != c.ok {
+			t.Errorf("%s: dial error %v", c.name, err)
+		}
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roader-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "player"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writePEM(t, cert, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	clientCert, _ := x509.ParseCertificate(der)
+
+	hs := httptest.NewUnstartedServer(upgradeAndClose)
+	hs.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: x509.NewCertPool()}
+	hs.TLS.ClientCAs.AddCert(clientCert)
+	hs.StartTLS()
+	defer hs.Close()
+	ca := filepath.Join(dir, "ca.pem")
+	writePEM(t, ca, "CERTIFICATE", hs.Certificate().Raw)
+
+	if err := dialTLS(hs, TLSConfig{CAFile: ca, CertFile: cert, KeyFile: keyFile}); err != nil {
+		t.Errorf("with client certificate: %v", err)
+	}
+	if err := dialTLS(hs, TLSConfig{CAFile: ca}); err == nil {
+		t.Error("server accepted client without certificate")
+	}
+}
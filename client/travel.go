@@ -0,0 +1,114 @@
+package client
+
+import (
+	"errors"
+	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/pathfind"
+)
+
+// ErrNoRoute is returned by Travel when the known board has no way to the cell
+var ErrNoRoute = errors.New("no known route")
+
+// travel is the cell own player walks to
+type travel struct {
+	Col, Row int
+}
+
+// Travel walks own player to the cell one move at a time. Next move is sent
+// after the server replied to the previous one, planned again over what is
+// known by then, so the first one waits for replies to moves already sent.
+// A refused move or manual Move ends the travel.
+// Called from the game loop goroutine like Loop.
+func (gs *GameSession) Travel(col, row int) error {
+	if gs.Model == nil || gs.Spectating() {
+		return ErrNoRoute
+	}
+	if col < 0 || row < 0 || col >= len(gs.Model.Matrix) || row >= len(gs.Model.Matrix[0]) {
+		return ErrNoRoute
+	}
+	if player := gs.Model.Players[gs.PlayerKey]; player != nil && player.Col == col && player.Row == row {
+		gs.travel = nil
+		return nil
+	}
+	if gs.route(col, row) == nil {
+		return ErrNoRoute
+	}
+	gs.travel = &travel{Col: col, Row: row}
+	gs.travelStep()
+	return nil
+}
+
+// Destination is the cell of current travel
+func (gs *GameSession) Destination() (col, row int, ok bool) {
+	if gs.travel == nil {
+		return 0, 0, false
+	}
+	return gs.travel.Col, gs.travel.Row, true
+}
+
+func (gs *GameSession) CancelTravel() {
+	gs.travel = nil
+}
+
+// travelStep sends next move of the travel unless own move is on its way
+func (gs *GameSession) travelStep() {
+	t := gs.travel
+	if t == nil || gs.unanswered > 0 {
+		return
+	}
+	moves := gs.route(t.Col, t.Row)
+	if len(moves) == 0 {
+		// arrived, or the way got closed
+		gs.travel = nil
+		return
+	}
+	select {
+	case gs.MessagesOut <- model.ClientMessage{Move: moves[0]}:
+		gs.unanswered++
+		gs.predictMove(moves[0])
+	default:
+		// outbound queue is full, try next frame
+	}
+}
+
+// travelReply ends the travel when own move was refused
+func (gs *GameSession) travelReply(ds model.DirectionSuccess) {
+	if !ds.Success && gs.own(ds) {
+		gs.travel = nil
+	}
+}
+
+// route is the shortest list of moves to the cell over known cells, using
+// locks the player has keys for and portals. Nil when there is none or the
+// player is already there.
+func (gs *GameSession) route(col, row int) []int {
+	player := gs.Model.Players[gs.PlayerKey]
+	if player == nil {
+		return nil
+	}
+	moves, _ := pathfind.AStar(gs.Model,
+		gs.Model.Matrix[player.Col][player.Row], gs.Model.Matrix[col][row],
+		pathfind.Options{
+			Keys:     player.Keys,
+			Portals:  true,
+			CanEnter: func(c *model.Cell) bool { return c.Player == nil },
+			// beyond known cells walls are not known
+			CanLeave: func(c *model.Cell) bool { return gs.Known(c.Col, c.Row) },
+		})
+	if len(moves) == 0 {
+		return nil
+	}
+	return moves
+}
+
+// Known tells the cell was seen, its walls are real
+func (gs *GameSession) Known(col, row int) bool {
+	return gs.known != nil && gs.known[col][row]
+}
+
+func (gs *GameSession) resetKnown(cols, rows int) {
+	gs.known = make([][]bool, cols)
+	for c := range gs.known {
+		gs.known[c] = make([]bool, rows)
+	}
+}
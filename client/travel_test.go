@@ -0,0 +1,99 @@
+package client
+
+import (
+	"github.com/zucenko/roader/model"
+	"testing"
+)
+
+// travelBoard is session on 3x2 board, wall between top cells 0 and 1, lock
+// between 1 and 2, bottom right cell not seen yet
+func travelBoard(cfg Config) *GameSession {
+	gs := NewGameSession(cfg)
+	open := func(col, row int, walls ...bool) model.Visibilize {
+		return model.Visibilize{Col: col, Row: row, Walls: walls, Locks: make([]bool, 4)}
+	}
+	lock := open(1, 0, true, false, true, true)
+	lock.Locks[0] = true
+	gs.apply(model.ServerMessage{
+		Setup: []model.Setup{{
+			Cols: 3, Rows: 2, PlayerKey: 'A',
+			Players: map[int32]model.Player{'A': {Id: 'A', Col: 0, Row: 0}}}},
+		Visibles: []model.Visibilize{
+			open(0, 0, true, false, true, true),
+			open(0, 1, false, true, true, false),
+			lock,
+			open(1, 1, true, true, false, false),
+		},
+	})
+	return gs
+}
+
+func TestTravel(t *testing.T) {
+	gs := travelBoard(DefaultConfig())
+	player := gs.Model.Players['A']
+
+	if err := gs.Travel(2, 0); err != ErrNoRoute {
+		t.Errorf("travel through lock without key: %v", err)
+	}
+	if err := gs.Travel(2, 1); err != ErrNoRoute {
+		t.Errorf("travel beyond known cells: %v", err)
+	}
+	if err := gs.Travel(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	var sent []int
+	for i := 0; i < 5 && len(gs.MessagesOut) > 0; i++ {
+		cm := <-gs.MessagesOut
+		sent = append(sent, cm.Move)
+		if len(gs.MessagesOut) > 0 {
+			t.Fatalf("next step sent before reply")
+		}
+		gs.MessagesIn.Push(model.ServerMessage{Directions: []model.DirectionSuccess{{
+			Direction: cm.Move, Col: player.Col, Row: player.Row, Success: true, PlayerKey: 'A'}}})
+		gs.Loop()
+	}
+	if len(sent) != 3 || sent[0] != 1 || sent[1] != 0 || sent[2] != 3 {
+		t.Errorf("sent moves %v", sent)
+	}
+	if _, _, ok := gs.Destination(); ok || player.Col != 1 || player.Row != 0 {
+		t.Errorf("travel ended at %d,%d", player.Col, player.Row)
+	}
+
+	// refused step ends travel
+	player.Keys = 1
+	if err := gs.Travel(2, 0); err != nil {
+		t.Fatal(err)
+	}
+	cm := <-gs.MessagesOut
+	gs.MessagesIn.Push(model.ServerMessage{Directions: []model.DirectionSuccess{{Direction: cm.Move}}})
+	gs.Loop()
+	if _, _, ok := gs.Destination(); ok || len(gs.MessagesOut) > 0 {
+		t.Errorf("travel goes on after refused move")
+	}
+}
+
+func TestTravelAfterMove(t *testing.T) {
+	for _, predict := range []bool{true, false} {
+		cfg := DefaultConfig()
+		cfg.Predict = predict
+		gs := travelBoard(cfg)
+		gs.Move(1)
+		<-gs.MessagesOut
+		if err := gs.Travel(1, 1); err != nil {
+			t.Fatal(err)
+		}
+		gs.Loop()
+		if len(gs.MessagesOut) > 0 {
+			t.Fatalf("predict %v: travel sent step before reply to manual move", predict)
+		}
+		gs.MessagesIn.Push(model.ServerMessage{Directions: []model.DirectionSuccess{{
+			Direction: 1, Col: 0, Row: 1, Success: true, PlayerKey: 'A'}}})
+		gs.Loop()
+		if len(gs.MessagesOut) != 1 {
+			t.Fatalf("predict %v: %d steps sent after reply", predict, len(gs.MessagesOut))
+		}
+		if cm := <-gs.MessagesOut; cm.Move != 0 {
+			t.Errorf("predict %v: travel from the moved player went %d", predict, cm.Move)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/audio"
+	"github.com/tanema/gween"
+	"github.com/tanema/gween/ease"
+	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/client"
+	"github.com/zucenko/roaderclient/gamming"
+	"log"
+	"math"
+)
+
+// bumpDuration is in tween time, update advances tweens by 0.02 a frame
+const bumpDuration = 0.5
+
+const sampleRate = 44100
+
+// Bump shows own move the server refused
+type Bump struct {
+	client.Reject
+	// Left runs from 1 down to 0 while the bump is shown
+	Left float32
+	// board the move was refused on, bump is not drawn on a rebuilt Model
+	board *model.Model
+}
+
+var audioContext *audio.Context
+var bumpSound *audio.Player
+
+// silent is set once audio failed, it is not tried again
+var silent bool
+
+// updateRejects turns refused moves into bumps, the last one wins
+func (play *Play) updateRejects() {
+	rejects := play.GameSession.Rejected()
+	for _, r := range rejects {
+		log.Printf("move %d rejected: %s", r.Move, r.Reason.Name())
+	}
+	if len(rejects) == 0 {
+		return
+	}
+	b := &Bump{Reject: rejects[len(rejects)-1], Left: 1, board: play.GameSession.Model}
+	play.Bump = b
+	play.Tweens[gween.New(1, 0, bumpDuration, ease.Linear)] = gamming.Action{
+		OnChange: func(v float32) { b.Left = v },
+		OnFinish: []func(){func() {
+			if play.Bump == b {
+				play.Bump = nil
+			}
+		}},
+	}
+	playBump()
+}
+
+// bumpOffset shakes own player ring along the refused direction
+func (play *Play) bumpOffset(id int32) (int, int) {
+	b := play.Bump
+	if b == nil || b.board != play.GameSession.Model || id != play.GameSession.PlayerKey {
+		return 0, 0
+	}
+	shift := int(math.Sin(float64(b.Left)*math.Pi*6) * float64(b.Left) * size / 8)
+	switch b.Move {
+	case 1:
+		return 0, shift
+	case 2:
+		return -shift, 0
+	case 3:
+		return 0, -shift
+	default:
+		return shift, 0
+	}
+}
+
+// drawBump flashes wall or lock that stopped the move
+func (play *Play) drawBump(screen *ebiten.Image, topX, topY int) {
+	b, m := play.Bump, play.GameSession.Model
+	if b == nil || b.Move < 0 || b.Move > 3 || b.board != m {
+		return
+	}
+	if b.Col < 0 || b.Col >= len(m.Matrix) || b.Row < 0 || b.Row >= len(m.Matrix[b.Col]) {
+		return
+	}
+	cell := m.Matrix[b.Col][b.Row]
+	flash := mix(COLOR_STONE, COLOR_WHITE, float64(b.Left))
+	switch b.Reason {
+	case client.REJECT_WALL, client.REJECT_EDGE:
+		Line.SetColor(flash.r, flash.g, flash.b)
+		drawWall(screen, b.Move, topX, topY, false, false, cell)
+	case client.REJECT_LOCK:
+		d := b.Move
+		if d > 1 {
+			// locks are drawn from the cell left or above
+			cell, d = cell.Paths[d].Target, d-2
+		}
+		imgDotSmall.color = mix(COLOR_STONE, COLOR_DIAMOND, float64(b.Left))
+		drawLock(screen, d, topX, topY, cell)
+	}
+}
+
+func mix(from, to GameColor, t float64) GameColor {
+	return GameColor{
+		r: from.r + (to.r-from.r)*t,
+		g: from.g + (to.g-from.g)*t,
+		b: from.b + (to.b-from.b)*t,
+	}
+}
+
+func playBump() {
+	if silent {
+		return
+	}
+	if bumpSound == nil {
+		var err error
+		if audioContext == nil {
+			if audioContext, err = audio.NewContext(sampleRate); err != nil {
+				log.Printf("audio %v, bumps are silent", err)
+				silent = true
+				return
+			}
+		}
+		if bumpSound, err = audio.NewPlayerFromBytes(audioContext, bumpPCM()); err != nil {
+			log.Printf("bump sound %v", err)
+			silent = true
+			return
+		}
+	}
+	bumpSound.Rewind()
+	bumpSound.Play()
+}
+
+// bumpPCM is short low thud, 16 bit stereo
+func bumpPCM() []byte {
+	const length = sampleRate / 12
+	buf := &bytes.Buffer{}
+	phase := 0.0
+	for i := 0; i < length; i++ {
+		t := float64(i) / length
+		// pitch falls from 160 to 60 Hz while the thud fades out
+		phase += 2 * math.Pi * (160 - 100*t) / sampleRate
+		v := int16(math.Sin(phase) * math.Exp(-5*t) * 0.6 * math.MaxInt16)
+		binary.Write(buf, binary.LittleEndian, [2]int16{v, v})
+	}
+	return buf.Bytes()
+}
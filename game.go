@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/golang/freetype/truetype"
 	"github.com/hajimehoshi/ebiten"
@@ -9,15 +11,16 @@ import (
 	"github.com/hajimehoshi/ebiten/inpututil"
 	"github.com/hajimehoshi/ebiten/text"
 	"github.com/tanema/gween"
-	"github.com/zucenko/roader/client"
 	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/client"
 	"github.com/zucenko/roaderclient/gamming"
 	"golang.org/x/image/font"
 	"image/color"
 	_ "image/png"
 	"log"
-	"math"
 	"math/rand"
+	"os"
+	"os/signal"
 	"time"
 )
 
@@ -154,6 +157,8 @@ type Stroke struct {
 	currentY int
 
 	released bool
+	// swiped is set once the stroke made a move, it is no tap then
+	swiped bool
 }
 
 func NewStroke(source StrokeSource) *Stroke {
@@ -194,6 +199,43 @@ func (s *Stroke) PositionDiff() (int, int) {
 	return dx, dy
 }
 
+// Swipe returns direction of drag longer than step along its dominant axis,
+// -1 when there is none. The start moves by one step towards the current
+// position, so calling it again chains next swipe of a long drag.
+func (s *Stroke) Swipe(step, deadZone int) int {
+	dx, dy := s.PositionDiff()
+	ax, ay := abs(dx), abs(dy)
+	switch {
+	case ax >= step && ax-ay >= deadZone:
+		s.swiped = true
+		// drift on the other axis must not add up to a move later
+		s.initY = s.currentY
+		if dx > 0 {
+			s.initX += step
+			return 0
+		}
+		s.initX -= step
+		return 2
+	case ay >= step && ay-ax >= deadZone:
+		s.swiped = true
+		s.initX = s.currentX
+		if dy > 0 {
+			s.initY += step
+			return 1
+		}
+		s.initY -= step
+		return 3
+	}
+	return -1
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
 type GameState int
 
 const (
@@ -224,14 +266,35 @@ type Play struct {
 	strokes     map[*Stroke]struct{}
 	Cols, Rows  int
 	Tweens      map[*gween.Tween]gamming.Action
+	ConnStates  <-chan client.StateEvent
+	ConnState   client.StateEvent
+	// Playback replaces the connection in replay mode
+	Playback *client.Playback
+	// Focus is the player spectator's HUD follows
+	Focus int32
+	// Lobby is shown instead of the board until joined room starts
+	Lobby *LobbyScreen
+	Chat  ChatInput
+	// Bump is the last refused own move while it is shown
+	Bump *Bump
+	// Gamepads are connected devices by ebiten gamepad id
+	Gamepads map[int]*Gamepad
+	Keymap   Keymap
+	// Settings is the key settings screen while open
+	Settings *SettingsScreen
 }
 
 func (play *Play) move(dir int) {
 	log.Printf(">> PRESSED %v", dir)
-	play.GameSession.MessagesOut <- model.ClientMessage{Move: dir}
+	play.GameSession.Move(dir)
 }
 
 var play *Play
+
+// interrupt stops ebiten.Run on SIGINT, teardown follows Run in main
+var interrupt = make(chan os.Signal, 1)
+
+var errInterrupted = errors.New("interrupted")
 var imgDiamond, imgDiamondIn, imgPortal, imgPlayer, imgDot, imgDotSmall, imgKey *Tile
 var bgImage, eImmF *ebiten.Image
 var Font font.Face
@@ -326,119 +389,108 @@ func init() {
 	imgDotSmall.SetSize(scale * .6)
 	imgDotSmall.SetColor(COLOR_STONE)
 
-	gs := client.NewGameSession()
-
 	//go c.ServerMessageProcessingLoop()
 
 	play = &Play{
-		strokes:     map[*Stroke]struct{}{},
-		Tweens:      make(map[*gween.Tween]gamming.Action),
-		State:       IDLE,
-		GameSession: gs,
+		strokes: map[*Stroke]struct{}{},
+		Tweens:  make(map[*gween.Tween]gamming.Action),
+		State:   IDLE,
+		Keymap:  DefaultKeymap(),
 		//ScoreLabel: prepareTextImage("00000"),
 		//LevelLabel: prepareTextImage("1"),
 		//score:      0,
 	}
-
-	//go gs.Loop()
-
-	gs.Connect("i.glow.cz:8080")
 }
 
+const (
+	// swipeStep is drag distance of one move, longer drag chains more moves
+	swipeStep = size / 2
+	// swipeDeadZone is how much longer the dominant axis must be, drags
+	// closer to diagonal are ignored
+	swipeDeadZone = size / 8
+)
+
 func (play *Play) updateStroke(stroke *Stroke) {
 	stroke.Update()
-	xDif, yDif := stroke.PositionDiff()
-	if math.Abs(float64(xDif)) > size/2 {
-		stroke.released = true
-	}
-
-	if math.Abs(float64(yDif)) > size/2 {
-		stroke.released = true
-		// send event
+	if play.Playback != nil || play.Settings != nil || play.GameSession.Spectating() {
+		return
 	}
-
-	if !stroke.IsReleased() {
+	if stroke.IsReleased() {
+		if !stroke.swiped {
+			play.travel(stroke.Position())
+		}
 		return
 	}
+	for d := stroke.Swipe(swipeStep, swipeDeadZone); d >= 0; d = stroke.Swipe(swipeStep, swipeDeadZone) {
+		play.move(d)
+	}
+}
 
-	//-----------------------------------------------------
-
-	//newX, _ := stroke.PositionDiff()
-	//dx := float32(newX - 0)
-
+// travel walks own player to the tapped cell
+func (play *Play) travel(x, y int) {
+	// cells are centered on multiples of size, board starts one cell in
+	col, row := (x+size/2)/size-1, (y+size/2)/size-1
+	if err := play.GameSession.Travel(col, row); err != nil {
+		log.Printf("travel to %d,%d: %v", col, row, err)
+	}
 }
 
 var scoreImg *ebiten.Image
 var keys, diamonds int
+var hudName string
 
-func prepareTextImage(keys int, diamonds int) *ebiten.Image {
-	image, _ := ebiten.NewImage(220, 55, ebiten.FilterLinear)
+func prepareTextImage(name string, keys int, diamonds int) *ebiten.Image {
+	width := 220
+	if w := font.MeasureString(Font, name).Ceil() + 10; w > width {
+		width = w
+	}
+	image, _ := ebiten.NewImage(width, 110, ebiten.FilterLinear)
 	image.Fill(color.RGBA{0, 0, 0, 105})
+	text.Draw(image, name, Font, 5, 45, color.White)
 
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(1, 1)
-	op.GeoM.Translate(5, 15)
+	op.GeoM.Translate(5, 70)
 	image.DrawImage(imgKey.image, op)
 	op = &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(1, 1)
-	op.GeoM.Translate(185, 15)
+	op.GeoM.Translate(185, 70)
 	image.DrawImage(imgDiamond.image, op)
 
-	text.Draw(image, fmt.Sprintf("%d     %d", keys, diamonds), Font, 45, 45, color.White)
+	text.Draw(image, fmt.Sprintf("%d     %d", keys, diamonds), Font, 45, 100, color.White)
 	return image
 }
 
+// keyRepeat is how held keys outside Keymap repeat
+var keyRepeat = Binding{Delay: 30, Interval: 3}
+
 func repeatingKeyPressed(key ebiten.Key) bool {
-	const (
-		delay    = 30
-		interval = 3
-	)
-	d := inpututil.KeyPressDuration(key)
-	if d == 1 {
-		return true
-	}
-	if d >= delay && (d-delay)%interval == 0 {
-		return true
-	}
-	return false
+	return keyRepeat.repeats(inpututil.KeyPressDuration(key))
 }
 
 func drawWall(screen *ebiten.Image, d int, topX int, topY int, lock bool, canUnlock bool, cell *model.Cell) {
-	switch d {
-	case 0:
-		if lock {
-			if canUnlock {
-				imgDotSmall.color = COLOR_WHITE
-			} else {
-				imgDotSmall.color = COLOR_STONE
-			}
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size-size/4)
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size)
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size+size/4)
+	if lock && d < 2 {
+		if canUnlock {
+			imgDotSmall.color = COLOR_WHITE
 		} else {
-			Line.SetPosition(
-				topX+cell.Col*size+size/2-wallWidth/2,
-				topY+cell.Row*size-size/2-wallWidth/2)
-			Line.SetSize(wallWidth, size+wallWidth)
-			Line.Draw(screen)
+			imgDotSmall.color = COLOR_STONE
 		}
+		drawLock(screen, d, topX, topY, cell)
+		return
+	}
+	switch d {
+	case 0:
+		Line.SetPosition(
+			topX+cell.Col*size+size/2-wallWidth/2,
+			topY+cell.Row*size-size/2-wallWidth/2)
+		Line.SetSize(wallWidth, size+wallWidth)
+		Line.Draw(screen)
 	case 1:
-		if lock {
-			if canUnlock {
-				imgDotSmall.color = COLOR_WHITE
-			} else {
-				imgDotSmall.color = COLOR_STONE
-			}
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size-size/4, topY+cell.Row*size+size/2)
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size, topY+cell.Row*size+size/2)
-			imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/4, topY+cell.Row*size+size/2)
-		} else {
-			Line.SetPosition(
-				topX+cell.Col*size-size/2-wallWidth/2,
-				topY+cell.Row*size+size/2-wallWidth/2)
-			Line.SetSize(size+wallWidth, wallWidth)
-			Line.Draw(screen)
-		}
+		Line.SetPosition(
+			topX+cell.Col*size-size/2-wallWidth/2,
+			topY+cell.Row*size+size/2-wallWidth/2)
+		Line.SetSize(size+wallWidth, wallWidth)
+		Line.Draw(screen)
 	case 2:
 		Line.SetPosition(topX+cell.Col*size-size/2-wallWidth/2, topY+cell.Row*size-size/2-wallWidth/2)
 		Line.SetSize(wallWidth, size+wallWidth)
@@ -450,6 +502,20 @@ func drawWall(screen *ebiten.Image, d int, topX int, topY int, lock bool, canUnl
 	}
 }
 
+// drawLock draws lock right (0) or below (1) the cell in imgDotSmall color
+func drawLock(screen *ebiten.Image, d int, topX int, topY int, cell *model.Cell) {
+	switch d {
+	case 0:
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size-size/4)
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size)
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/2, topY+cell.Row*size+size/4)
+	case 1:
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size-size/4, topY+cell.Row*size+size/2)
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size, topY+cell.Row*size+size/2)
+		imgDotSmall.DrawCentered(screen, topX+cell.Col*size+size/4, topY+cell.Row*size+size/2)
+	}
+}
+
 func colorForPlayer(playerKey int32) GameColor {
 	switch playerKey {
 	case 'A':
@@ -465,8 +531,30 @@ func colorForPlayer(playerKey int32) GameColor {
 
 func (play *Play) update(screen *ebiten.Image) error {
 	//log.Print("dddddd")
+	select {
+	case <-interrupt:
+		return errInterrupted
+	default:
+	}
 
+	if play.Lobby != nil && play.updateLobby(screen) {
+		return nil
+	}
+	if play.Playback != nil {
+		play.updatePlayback()
+	}
 	play.GameSession.Loop()
+	play.updateRejects()
+
+states:
+	for {
+		select {
+		case e := <-play.ConnStates:
+			play.ConnState = e
+		default:
+			break states
+		}
+	}
 
 	// tween
 	for t, a := range play.Tweens {
@@ -489,20 +577,22 @@ func (play *Play) update(screen *ebiten.Image) error {
 		}
 	}
 
-	if repeatingKeyPressed(ebiten.KeyRight) {
-		play.move(0)
-	}
-	if repeatingKeyPressed(ebiten.KeyDown) {
-		play.move(1)
-	}
-	if repeatingKeyPressed(ebiten.KeyLeft) {
-		play.move(2)
-	}
-	if repeatingKeyPressed(ebiten.KeyUp) {
-		play.move(3)
-	}
-	if repeatingKeyPressed(ebiten.KeySpace) {
-		play.move(4)
+	play.updateGamepads()
+	// while typing or editing keys the keyboard belongs to the open box
+	typing := play.updateSettings() || play.Playback == nil && play.updateChat()
+	if play.GameSession.Spectating() && !typing {
+		play.updateSpectator()
+	} else if play.Playback == nil && !typing {
+		for a := ACTION_MOVE_RIGHT; a <= ACTION_TELEPORT; a++ {
+			if play.Keymap.Pressed(a) {
+				play.move(int(a))
+			}
+		}
+		for _, pad := range play.Gamepads {
+			for _, d := range pad.moves(play.Keymap) {
+				play.move(d)
+			}
+		}
 	}
 
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
@@ -539,11 +629,14 @@ func (play *Play) update(screen *ebiten.Image) error {
 
 	if play.GameSession.Model != nil {
 
-		if play.GameSession.Model.Players[play.GameSession.PlayerKey].Diamonds != diamonds ||
-			play.GameSession.Model.Players[play.GameSession.PlayerKey].Keys != keys {
-			diamonds = play.GameSession.Model.Players[play.GameSession.PlayerKey].Diamonds
-			keys = play.GameSession.Model.Players[play.GameSession.PlayerKey].Keys
-			scoreImg = prepareTextImage(keys, diamonds)
+		if focused := play.GameSession.Model.Players[play.focus()]; focused != nil {
+			name := play.GameSession.Name(focused.Id)
+			if focused.Diamonds != diamonds || focused.Keys != keys || name != hudName {
+				diamonds = focused.Diamonds
+				keys = focused.Keys
+				hudName = name
+				scoreImg = prepareTextImage(hudName, keys, diamonds)
+			}
 		}
 
 		for c := 0; c < len(play.GameSession.Model.Matrix); c++ {
@@ -621,6 +714,12 @@ func (play *Play) update(screen *ebiten.Image) error {
 			}
 		}
 
+		play.drawBump(screen, topX, topY)
+		if col, row, ok := play.GameSession.Destination(); ok {
+			imgDotSmall.color = colorForPlayer(play.GameSession.PlayerKey)
+			imgDotSmall.DrawCentered(screen, topX+col*size, topY+row*size)
+		}
+
 		for c := 0; c < len(play.GameSession.Model.Matrix); c++ {
 			for r := 0; r < len(play.GameSession.Model.Matrix[0]); r++ {
 				cell := play.GameSession.Model.Matrix[c][r]
@@ -657,19 +756,34 @@ func (play *Play) update(screen *ebiten.Image) error {
 
 				// PLAYER
 				if cell.Player != nil {
+					dx, dy := play.bumpOffset(cell.Player.Id)
 					if cell.Portal == nil {
 						imgPlayer.SetColor(colorForPlayer(cell.Player.Id))
 						//log.Printf("[%d,%d] %v",c,r,cell.PlayerId.Id)
-						imgPlayer.DrawCentered(screen, topX+c*size, topY+r*size)
+						imgPlayer.DrawCentered(screen, topX+c*size+dx, topY+r*size+dy)
 					}
 					imgDot.SetColor(colorForPlayer(cell.Player.Id))
-					imgDot.DrawCentered(screen, topX+c*size, topY+r*size)
+					imgDot.DrawCentered(screen, topX+c*size+dx, topY+r*size+dy)
+					ebitenutil.DebugPrintAt(screen, play.GameSession.Name(cell.Player.Id),
+						topX+c*size+size/3, topY+r*size-size/2-6)
 				}
 
 			}
 		}
 
 	}
+	if play.GameSession.Spectating() && play.GameSession.Model != nil {
+		play.drawSpectator(screen)
+	}
+	play.drawChat(screen)
+	if play.Settings != nil {
+		play.drawSettings(screen)
+	}
+	if play.Playback != nil {
+		play.drawPlayback(screen)
+	} else {
+		play.drawConnState(screen)
+	}
 	if scoreImg != nil {
 		op := &ebiten.DrawImageOptions{}
 		op.GeoM.Scale(1, 1)
@@ -696,9 +810,93 @@ func (play *Play) update(screen *ebiten.Image) error {
 	return nil
 }
 
+func (play *Play) drawConnState(screen *ebiten.Image) {
+	e := play.ConnState
+	if e.State == client.CS_CONNECTED {
+		if st := play.GameSession.Latency(); st.Samples > 0 {
+			ll := play.GameSession.LastLoop
+			ebitenutil.DebugPrintAt(screen, fmt.Sprintf("rtt %v ~%v msgs %d/%d predicted %d/%d",
+				st.Mean.Round(time.Millisecond), st.Jitter.Round(time.Millisecond),
+				ll.Applied, ll.Pending,
+				play.GameSession.Predicted(), play.GameSession.Mispredicted), 4, 4)
+		}
+		return
+	}
+	msg := e.State.Name()
+	if e.Attempt > 0 {
+		msg = fmt.Sprintf("%s attempt %d", msg, e.Attempt)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	ebitenutil.DebugPrintAt(screen, msg, 4, 4)
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			serve(os.Args[2:])
+			return
+		case "replay":
+			replay(os.Args[2:])
+			return
+		}
+	}
+	cfg, err := client.LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	gamepadMappings = loadGamepadMappings(GamepadMappingsFile)
+	if play.Keymap, err = LoadKeymap(KeymapFile); err != nil {
+		log.Printf("%v, using default keys", err)
+	}
+	if cfg.Lobby {
+		if play.Lobby, err = NewLobbyScreen(cfg); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		gs, err := startSession(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		play.GameSession = gs
+		play.ConnStates = gs.Subscribe()
+	}
+
+	signal.Notify(interrupt, os.Interrupt)
 	ebiten.SetRunnableInBackground(true)
-	if err := ebiten.Run(play.update, screenWidth, screenHeight, 1, "Roader"); err != nil {
+	err = ebiten.Run(play.update, screenWidth, screenHeight, 1, "Roader")
+	play.close()
+	if err != nil && err != errInterrupted {
 		log.Fatal(err)
 	}
 }
+
+// startSession connects new GameSession, recording it when configured
+func startSession(cfg client.Config) (*client.GameSession, error) {
+	gs := client.NewGameSession(cfg)
+	if cfg.ReplayDir != "" {
+		rec, err := client.CreateReplay(cfg.ReplayDir, cfg)
+		if err != nil {
+			log.Printf("recording disabled: %v", err)
+		} else {
+			gs.Recorder = rec
+		}
+	}
+	if err := gs.Connect(context.Background()); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+func (play *Play) close() {
+	if play.Lobby != nil {
+		play.Lobby.Lobby.Close()
+	}
+	if play.GameSession != nil {
+		if err := play.GameSession.Close(); err != nil {
+			log.Printf("session closed: %v", err)
+		}
+	}
+}
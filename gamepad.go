@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"log"
+	"math"
+	"os"
+)
+
+// GamepadMappingsFile overrides mappings of devices whose buttons differ
+// from DefaultGamepadMapping of the platform
+const GamepadMappingsFile = "gamepads.json"
+
+// GamepadMapping says which buttons and stick move the player
+type GamepadMapping struct {
+	// Buttons for move 0..4, right, down, left, up and portal
+	Buttons [5]ebiten.GamepadButton `json:"buttons"`
+	// Hat takes the moves from d-pad reported as hat, desktop GLFW appends
+	// it after other buttons as up, right, down, left; Buttons 0..3 are ignored
+	Hat bool `json:"hat"`
+	// AxisX and AxisY of the stick, -1 disables it
+	AxisX int `json:"axis_x"`
+	AxisY int `json:"axis_y"`
+	// DeadZone is stick deflection ignored around the center, 0..1
+	DeadZone float64 `json:"dead_zone"`
+}
+
+// Gamepad is connected device with its mapping and stick state
+type Gamepad struct {
+	ID      int
+	Name    string
+	Mapping GamepadMapping
+	// stick is direction the stick is held in, -1 when centered, held
+	// counts frames for repeat
+	stick int
+	held  int
+}
+
+// gamepadMappings are read from GamepadMappingsFile keyed by SDL id or
+// device name, "default" replaces DefaultGamepadMapping
+var gamepadMappings map[string]GamepadMapping
+
+// loadGamepadMappings reads optional mappings file, missing file is fine
+func loadGamepadMappings(path string) map[string]GamepadMapping {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("gamepad mappings: %v", err)
+		return nil
+	}
+	defer f.Close()
+	mappings := map[string]GamepadMapping{}
+	if err := json.NewDecoder(f).Decode(&mappings); err != nil {
+		log.Printf("gamepad mappings %s: %v", path, err)
+		return nil
+	}
+	return mappings
+}
+
+func mappingFor(id int) GamepadMapping {
+	m := DefaultGamepadMapping
+	for _, key := range []string{ebiten.GamepadSDLID(id), ebiten.GamepadName(id), "default"} {
+		if found, ok := gamepadMappings[key]; ok && key != "" {
+			m = found
+			break
+		}
+	}
+	if m.Hat {
+		// without hat buttons the pad moves by stick only
+		m.Buttons[0], m.Buttons[1], m.Buttons[2], m.Buttons[3] = -1, -1, -1, -1
+		if n := ebiten.GamepadButtonNum(id); n >= 4 {
+			up := ebiten.GamepadButton(n - 4)
+			m.Buttons[0], m.Buttons[1], m.Buttons[2], m.Buttons[3] = up+1, up+2, up+3, up
+		}
+	}
+	return m
+}
+
+// updateGamepads tracks plugged and unplugged devices
+func (play *Play) updateGamepads() {
+	if play.Gamepads == nil {
+		play.Gamepads = make(map[int]*Gamepad)
+		// devices present at start are not reported as just connected
+		for _, id := range ebiten.GamepadIDs() {
+			play.connectGamepad(id)
+		}
+	}
+	for _, id := range inpututil.JustConnectedGamepadIDs() {
+		play.connectGamepad(id)
+	}
+	for id := range play.Gamepads {
+		if inpututil.IsGamepadJustDisconnected(id) {
+			log.Printf("gamepad %d %q disconnected", id, play.Gamepads[id].Name)
+			delete(play.Gamepads, id)
+		}
+	}
+}
+
+func (play *Play) connectGamepad(id int) {
+	if _, found := play.Gamepads[id]; found {
+		return
+	}
+	pad := &Gamepad{ID: id, Name: ebiten.GamepadName(id), Mapping: mappingFor(id), stick: -1}
+	play.Gamepads[id] = pad
+	log.Printf("gamepad %d %q connected", id, pad.Name)
+}
+
+// moves returns moves requested on the pad this frame, held buttons and
+// stick repeat like keys of the move action
+func (pad *Gamepad) moves(k Keymap) []int {
+	var moves []int
+	for move, button := range pad.Mapping.Buttons {
+		if button >= 0 && k[Action(move)].repeats(inpututil.GamepadButtonPressDuration(pad.ID, button)) {
+			moves = append(moves, move)
+		}
+	}
+	if d := pad.stickDirection(); d != pad.stick {
+		pad.stick, pad.held = d, 0
+	}
+	if pad.stick >= 0 {
+		pad.held++
+		if k[Action(pad.stick)].repeats(pad.held) {
+			moves = append(moves, pad.stick)
+		}
+	}
+	return moves
+}
+
+// stickDirection is the dominant axis direction outside the dead zone, -1 inside
+func (pad *Gamepad) stickDirection() int {
+	m := pad.Mapping
+	axes := ebiten.GamepadAxisNum(pad.ID)
+	if m.AxisX < 0 || m.AxisY < 0 || m.AxisX >= axes || m.AxisY >= axes {
+		return -1
+	}
+	x, y := ebiten.GamepadAxis(pad.ID, m.AxisX), ebiten.GamepadAxis(pad.ID, m.AxisY)
+	if math.Hypot(x, y) < m.DeadZone {
+		return -1
+	}
+	if math.Abs(x) >= math.Abs(y) {
+		if x > 0 {
+			return 0
+		}
+		return 2
+	}
+	if y > 0 {
+		return 1
+	}
+	return 3
+}
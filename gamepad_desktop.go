@@ -0,0 +1,16 @@
+//go:build !js
+// +build !js
+
+package main
+
+import "github.com/hajimehoshi/ebiten"
+
+// DefaultGamepadMapping follows GLFW, button indices differ between devices,
+// only the d-pad hat buttons are always last and the south button first
+var DefaultGamepadMapping = GamepadMapping{
+	Buttons:  [5]ebiten.GamepadButton{-1, -1, -1, -1, 0},
+	Hat:      true,
+	AxisX:    0,
+	AxisY:    1,
+	DeadZone: 0.35,
+}
@@ -0,0 +1,11 @@
+package main
+
+import "github.com/hajimehoshi/ebiten"
+
+// DefaultGamepadMapping is the standard gamepad layout browsers report
+var DefaultGamepadMapping = GamepadMapping{
+	Buttons:  [5]ebiten.GamepadButton{15, 13, 14, 12, 0},
+	AxisX:    0,
+	AxisY:    1,
+	DeadZone: 0.35,
+}
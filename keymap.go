@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// KeymapFile keeps bindings changed in the settings screen
+const KeymapFile = "keymap.json"
+
+// Action is what the player can do with a key, bindings are in Keymap
+type Action int
+
+// move actions are the model move numbers
+const (
+	ACTION_MOVE_RIGHT Action = iota
+	ACTION_MOVE_DOWN
+	ACTION_MOVE_LEFT
+	ACTION_MOVE_UP
+	ACTION_TELEPORT
+	ACTION_CHAT
+	ACTION_FOCUS_NEXT
+	ACTION_SETTINGS
+	actionCount
+)
+
+func (a Action) Name() string {
+	switch a {
+	case ACTION_MOVE_RIGHT:
+		return "move_right"
+	case ACTION_MOVE_DOWN:
+		return "move_down"
+	case ACTION_MOVE_LEFT:
+		return "move_left"
+	case ACTION_MOVE_UP:
+		return "move_up"
+	case ACTION_TELEPORT:
+		return "teleport"
+	case ACTION_CHAT:
+		return "chat"
+	case ACTION_FOCUS_NEXT:
+		return "focus_next"
+	case ACTION_SETTINGS:
+		return "settings"
+	default:
+		return fmt.Sprintf("N/A(%d)", a)
+	}
+}
+
+// Binding is keys of one action and how it repeats while held
+type Binding struct {
+	Keys []ebiten.Key
+	// Delay is frames before held key starts repeating, 0 never repeats
+	Delay int
+	// Interval is frames between repeats
+	Interval int
+}
+
+// repeats tells whether input held for d frames fires this frame
+func (b *Binding) repeats(d int) bool {
+	if d == 1 {
+		return true
+	}
+	return b.Delay > 0 && d >= b.Delay && (d-b.Delay)%b.Interval == 0
+}
+
+// Keymap binds every action, an action may have several keys
+type Keymap map[Action]*Binding
+
+func DefaultKeymap() Keymap {
+	move := func(keys ...ebiten.Key) *Binding {
+		return &Binding{Keys: keys, Delay: 30, Interval: 3}
+	}
+	once := func(keys ...ebiten.Key) *Binding {
+		return &Binding{Keys: keys}
+	}
+	return Keymap{
+		ACTION_MOVE_RIGHT: move(ebiten.KeyRight, ebiten.KeyD, ebiten.KeyL),
+		ACTION_MOVE_DOWN:  move(ebiten.KeyDown, ebiten.KeyS, ebiten.KeyJ),
+		ACTION_MOVE_LEFT:  move(ebiten.KeyLeft, ebiten.KeyA, ebiten.KeyH),
+		ACTION_MOVE_UP:    move(ebiten.KeyUp, ebiten.KeyW, ebiten.KeyK),
+		ACTION_TELEPORT:   move(ebiten.KeySpace),
+		ACTION_CHAT:       once(ebiten.KeyEnter),
+		ACTION_FOCUS_NEXT: once(ebiten.KeyTab),
+		ACTION_SETTINGS:   once(ebiten.KeyF1),
+	}
+}
+
+// Pressed tells the action fires this frame, repeating while held
+func (k Keymap) Pressed(a Action) bool {
+	b := k[a]
+	if b == nil {
+		return false
+	}
+	for _, key := range b.Keys {
+		if b.repeats(inpututil.KeyPressDuration(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bound returns action the key triggers
+func (k Keymap) Bound(key ebiten.Key) (Action, bool) {
+	for a := Action(0); a < actionCount; a++ {
+		if b := k[a]; b != nil {
+			for _, bk := range b.Keys {
+				if bk == key {
+					return a, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// Bind adds key to the action, taking it from any other one. It returns false
+// and binds nothing when the key is the last one opening settings.
+func (k Keymap) Bind(a Action, key ebiten.Key) bool {
+	if other, found := k.Bound(key); found {
+		if other == a {
+			return true
+		}
+		if other == ACTION_SETTINGS && len(k[other].Keys) == 1 {
+			return false
+		}
+		keys := k[other].Keys[:0]
+		for _, bk := range k[other].Keys {
+			if bk != key {
+				keys = append(keys, bk)
+			}
+		}
+		k[other].Keys = keys
+	}
+	k[a].Keys = append(k[a].Keys, key)
+	return true
+}
+
+// Clear unbinds keys of the action. Settings get their default keys back,
+// without a key the settings screen could never be opened again.
+func (k Keymap) Clear(a Action) {
+	k[a].Keys = nil
+	if a == ACTION_SETTINGS {
+		k.restore(a)
+	}
+}
+
+// restore binds default keys of the action not bound to anything else,
+// when all are taken the first one is taken back
+func (k Keymap) restore(a Action) {
+	defaults := DefaultKeymap()[a].Keys
+	for _, key := range defaults {
+		if _, found := k.Bound(key); !found {
+			k[a].Keys = append(k[a].Keys, key)
+		}
+	}
+	if len(k[a].Keys) == 0 {
+		k.Bind(a, defaults[0])
+	}
+}
+
+// KeyNames lists the action keys for display
+func (k Keymap) KeyNames(a Action) string {
+	var names []string
+	for _, key := range k[a].Keys {
+		names = append(names, key.String())
+	}
+	return strings.Join(names, " ")
+}
+
+// keymapEntry is Binding in the file, keys by name
+type keymapEntry struct {
+	Keys     []string `json:"keys"`
+	Delay    int      `json:"delay"`
+	Interval int      `json:"interval"`
+}
+
+// LoadKeymap returns defaults overlaid with actions found in the file,
+// missing file is not an error. Actions may be left without keys, except
+// settings which get their default keys back.
+func LoadKeymap(path string) (Keymap, error) {
+	k := DefaultKeymap()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return k, nil
+	}
+	if err != nil {
+		return k, fmt.Errorf("keymap: %w", err)
+	}
+	entries := map[string]keymapEntry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return k, fmt.Errorf("keymap %s: %w", path, err)
+	}
+	keys := keysByName()
+	for a := Action(0); a < actionCount; a++ {
+		e, found := entries[a.Name()]
+		if !found {
+			continue
+		}
+		if e.Delay < 0 || e.Delay > 0 && e.Interval <= 0 {
+			return k, fmt.Errorf("keymap %s: %s repeats every %d frames after %d", path, a.Name(), e.Interval, e.Delay)
+		}
+		b := &Binding{Delay: e.Delay, Interval: e.Interval}
+		for _, name := range e.Keys {
+			key, found := keys[name]
+			if !found {
+				return k, fmt.Errorf("keymap %s: %s has unknown key %q", path, a.Name(), name)
+			}
+			b.Keys = append(b.Keys, key)
+		}
+		k[a] = b
+	}
+	if len(k[ACTION_SETTINGS].Keys) == 0 {
+		k.restore(ACTION_SETTINGS)
+	}
+	return k, nil
+}
+
+// Save writes every action binding to the file
+func (k Keymap) Save(path string) error {
+	entries := map[string]keymapEntry{}
+	for a, b := range k {
+		e := keymapEntry{Keys: []string{}, Delay: b.Delay, Interval: b.Interval}
+		for _, key := range b.Keys {
+			e.Keys = append(e.Keys, key.String())
+		}
+		entries[a.Name()] = e
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("keymap: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("keymap: %w", err)
+	}
+	return nil
+}
+
+func keysByName() map[string]ebiten.Key {
+	keys := make(map[string]ebiten.Key)
+	for k := ebiten.Key(0); k <= ebiten.KeyMax; k++ {
+		if name := k.String(); name != "" {
+			keys[name] = k
+		}
+	}
+	return keys
+}
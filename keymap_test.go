@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/hajimehoshi/ebiten"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeymapClearSurvivesLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roader-keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, KeymapFile)
+
+	k := DefaultKeymap()
+	k.Clear(ACTION_TELEPORT)
+	k.Clear(ACTION_SETTINGS)
+	if err := k.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeymap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := loaded[ACTION_TELEPORT].Keys; len(keys) != 0 {
+		t.Errorf("cleared teleport loaded with %v", keys)
+	}
+	if a, _ := loaded.Bound(ebiten.KeySpace); a == ACTION_TELEPORT {
+		t.Error("space bound to teleport again")
+	}
+	if keys := loaded[ACTION_SETTINGS].Keys; len(keys) != 1 || keys[0] != ebiten.KeyF1 {
+		t.Errorf("settings loaded with %v", keys)
+	}
+
+	// settings left empty in the file take F1 back from other action
+	loaded.Bind(ACTION_CHAT, ebiten.KeyF2)
+	loaded[ACTION_SETTINGS].Keys = nil
+	loaded[ACTION_CHAT].Keys = append(loaded[ACTION_CHAT].Keys, ebiten.KeyF1)
+	if err := loaded.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = LoadKeymap(path); err != nil {
+		t.Fatal(err)
+	}
+	if a, found := loaded.Bound(ebiten.KeyF1); !found || a != ACTION_SETTINGS {
+		t.Errorf("F1 bound to %s", a.Name())
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/zucenko/roaderclient/client"
+	"strings"
+	"time"
+)
+
+const lobbyTimeout = 5 * time.Second
+
+// roomSizes are the board sizes S cycles through, largest fits the window
+var roomSizes = [][2]int{{10, 7}, {15, 10}, {20, 13}}
+
+// LobbyScreen lists rooms before the game, it stays up until the joined
+// room starts. Lobby requests run in background and hand results back
+// through results, so update never blocks.
+type LobbyScreen struct {
+	Config   client.Config
+	Lobby    *client.Lobby
+	Selected int
+	// Code is invite code being typed
+	Code     string
+	Settings client.RoomSettings
+	// Room is the joined room, nil while choosing
+	Room   *client.Room
+	Status string
+
+	size    int
+	results chan func()
+}
+
+func NewLobbyScreen(cfg client.Config) (*LobbyScreen, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lobbyTimeout)
+	defer cancel()
+	lobby, err := client.DialLobby(ctx, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	size := len(roomSizes) - 1
+	return &LobbyScreen{
+		Config: cfg,
+		Lobby:  lobby,
+		Settings: client.RoomSettings{
+			Cols: roomSizes[size][0], Rows: roomSizes[size][1], Players: 2},
+		size:    size,
+		results: make(chan func(), 4),
+	}, nil
+}
+
+// async runs lobby request in background, done is applied in update
+func (ls *LobbyScreen) async(status string, request func(ctx context.Context) func()) {
+	ls.Status = status
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lobbyTimeout)
+		defer cancel()
+		ls.results <- request(ctx)
+	}()
+}
+
+func (ls *LobbyScreen) join(room client.Room) {
+	cfg := ls.Config
+	cfg.Room, cfg.Invite = room.Id, ""
+	ls.Room = &room
+	ls.async("joining room "+room.Id, func(ctx context.Context) func() {
+		gs, err := startSession(cfg)
+		return func() {
+			if err != nil {
+				ls.Room = nil
+				ls.Status = err.Error()
+				return
+			}
+			ls.Status = ""
+			play.GameSession = gs
+			play.ConnStates = gs.Subscribe()
+		}
+	})
+}
+
+// updateLobby returns true while lobby covers the whole screen
+func (play *Play) updateLobby(screen *ebiten.Image) bool {
+	ls := play.Lobby
+	select {
+	case done := <-ls.results:
+		done()
+	default:
+	}
+	if ls.Room != nil {
+		if gs := play.GameSession; gs != nil && gs.State() == client.CS_CLOSED {
+			// server refused the room, it started meanwhile or is gone
+			ls.Room = nil
+			ls.Status = fmt.Sprintf("room refused: %v", gs.Err())
+			gs.Close()
+			play.GameSession, play.ConnStates = nil, nil
+			return true
+		}
+		if play.GameSession != nil && play.GameSession.Model != nil {
+			ls.Lobby.Close()
+			play.Lobby = nil
+			return false
+		}
+		if play.GameSession != nil {
+			play.GameSession.Loop()
+		}
+		ls.drawWaiting(screen)
+		return true
+	}
+
+	rooms := ls.Lobby.Rooms()
+	for _, r := range ebiten.InputChars() {
+		if r >= '0' && r <= '9' {
+			ls.Code += string(r)
+		}
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace) && len(ls.Code) > 0:
+		ls.Code = ls.Code[:len(ls.Code)-1]
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		ls.Code = ""
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp) && ls.Selected > 0:
+		ls.Selected--
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown) && ls.Selected < len(rooms)-1:
+		ls.Selected++
+	case inpututil.IsKeyJustPressed(ebiten.KeyRightBracket) && ls.Settings.Players < len(COLORS):
+		ls.Settings.Players++
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeftBracket) && ls.Settings.Players > 1:
+		ls.Settings.Players--
+	case inpututil.IsKeyJustPressed(ebiten.KeyS):
+		ls.size = (ls.size + 1) % len(roomSizes)
+		ls.Settings.Cols, ls.Settings.Rows = roomSizes[ls.size][0], roomSizes[ls.size][1]
+	case inpututil.IsKeyJustPressed(ebiten.KeyN), inpututil.IsKeyJustPressed(ebiten.KeyP):
+		settings := ls.Settings
+		settings.Private = inpututil.IsKeyJustPressed(ebiten.KeyP)
+		ls.async("creating room", func(ctx context.Context) func() {
+			room, err := ls.Lobby.Create(ctx, settings)
+			return func() {
+				if err != nil {
+					ls.Status = err.Error()
+					return
+				}
+				ls.join(room)
+			}
+		})
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter) && ls.Code != "":
+		code := ls.Code
+		ls.async("looking up invite "+code, func(ctx context.Context) func() {
+			room, err := ls.Lobby.Find(ctx, code)
+			return func() {
+				if err != nil {
+					ls.Status = err.Error()
+					return
+				}
+				ls.join(room)
+			}
+		})
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter) && ls.Selected < len(rooms):
+		ls.join(rooms[ls.Selected])
+	}
+	if err := ls.Lobby.Err(); err != nil {
+		ls.Status = "lobby: " + err.Error()
+	}
+	ls.drawRooms(screen, rooms)
+	return true
+}
+
+func (ls *LobbyScreen) drawRooms(screen *ebiten.Image, rooms []client.Room) {
+	y := 10
+	line := func(format string, args ...interface{}) {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf(format, args...), 20, y)
+		y += 16
+	}
+	line("ROOMS   up/down select, enter join")
+	if len(rooms) == 0 {
+		line("  no open rooms")
+	}
+	for i, r := range rooms {
+		mark := " "
+		if i == ls.Selected {
+			mark = ">"
+		}
+		state := "waiting"
+		if r.Started {
+			state = "playing"
+		}
+		line("%s #%-4s %-16s %dx%d  %d/%d %s  %s", mark, r.Id, r.Name, r.Cols, r.Rows,
+			len(r.Waiting), r.Players, playerNames(r), state)
+	}
+	y += 16
+	line("INVITE CODE: %s_   type digits, enter join, esc clear", ls.Code)
+	line("NEW ROOM: %dx%d (s) %d players ([ ])   n public, p private",
+		ls.Settings.Cols, ls.Settings.Rows, ls.Settings.Players)
+	if ls.Status != "" {
+		y += 16
+		line("%s", ls.Status)
+	}
+}
+
+func (ls *LobbyScreen) drawWaiting(screen *ebiten.Image) {
+	room := *ls.Room
+	if r, found := ls.Lobby.Room(room.Id); found {
+		room.Waiting, room.Names = r.Waiting, r.Names
+	}
+	msg := fmt.Sprintf("ROOM #%s %s %dx%d\nwaiting %d/%d: %s", room.Id, room.Name,
+		room.Cols, room.Rows, len(room.Waiting), room.Players, playerNames(room))
+	if room.Code != "" {
+		msg += "\ninvite code " + room.Code
+	}
+	if ls.Status != "" {
+		msg += "\n" + ls.Status
+	}
+	ebitenutil.DebugPrintAt(screen, msg, 20, 10)
+}
+
+func playerNames(room client.Room) string {
+	names := make([]string, len(room.Waiting))
+	for i, key := range room.Waiting {
+		names[i] = string(rune(key))
+		if name := room.Names[key]; name != "" {
+			names[i] = name
+		}
+	}
+	return strings.Join(names, ", ")
+}
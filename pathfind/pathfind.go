@@ -0,0 +1,218 @@
+// Package pathfind searches model.Model boards. Moves are the model move
+// numbers, 0-3 along Cell.Paths and 4 through the portal. A wall blocks
+// unless it is a lock and a key is left in Options.Keys, every opened lock
+// spends one. Keys lying on the board are not counted.
+package pathfind
+
+import (
+	"container/heap"
+	"github.com/zucenko/roader/model"
+)
+
+// MovePortal is move through the portal of the cell
+const MovePortal = 4
+
+// Options say what a search may use, zero value walks open paths only
+type Options struct {
+	// Keys is how many locks may be opened
+	Keys int
+	// Portals allows portal moves
+	Portals bool
+	// CanEnter tells the cell may be stepped on, nil allows every cell
+	CanEnter func(*model.Cell) bool
+	// CanLeave tells moves out of the cell are known, nil allows every cell
+	CanLeave func(*model.Cell) bool
+}
+
+// state is cell reached with keys left, same cell with more keys is another state
+type state struct {
+	cell *model.Cell
+	keys int
+}
+
+type edge struct {
+	to   state
+	move int
+}
+
+// next lists states one move from s
+func (o Options) next(s state) []edge {
+	if o.CanLeave != nil && !o.CanLeave(s.cell) {
+		return nil
+	}
+	var out []edge
+	for d, path := range s.cell.Paths {
+		if path == nil || path.Target == nil {
+			continue
+		}
+		to := state{path.Target, s.keys}
+		if path.Wall {
+			if !path.Lock || s.keys == 0 {
+				continue
+			}
+			to.keys--
+		}
+		if o.CanEnter == nil || o.CanEnter(to.cell) {
+			out = append(out, edge{to, d})
+		}
+	}
+	if o.Portals && s.cell.Portal != nil {
+		to := state{s.cell.Portal.Target, s.keys}
+		if o.CanEnter == nil || o.CanEnter(to.cell) {
+			out = append(out, edge{to, MovePortal})
+		}
+	}
+	return out
+}
+
+// moves walks back from the goal state to the start
+func moves(prev map[state]edge, start, goal state) []int {
+	out := []int{}
+	for s := goal; s != start; s = prev[s].to {
+		out = append(out, prev[s].move)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// BFS returns the shortest moves from one cell to another, empty when they
+// are the same cell and false when there is no way
+func BFS(from, to *model.Cell, o Options) ([]int, bool) {
+	start := state{from, o.Keys}
+	// prev holds edge back to the previous state, move is the one taken
+	prev := map[state]edge{start: {}}
+	queue := []state{start}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		if s.cell == to {
+			return moves(prev, start, s), true
+		}
+		for _, e := range o.next(s) {
+			if _, seen := prev[e.to]; !seen {
+				prev[e.to] = edge{s, e.move}
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return nil, false
+}
+
+// AStar finds the same length route as BFS visiting fewer cells on big
+// boards, guided by distance that counts the portals
+func AStar(m *model.Model, from, to *model.Cell, o Options) ([]int, bool) {
+	h := heuristic(m, to, o)
+	start := state{from, o.Keys}
+	prev := map[state]edge{start: {}}
+	cost := map[state]int{start: 0}
+	open := &frontier{{start, h(from)}}
+	for open.Len() > 0 {
+		s := heap.Pop(open).(scored).state
+		if s.cell == to {
+			return moves(prev, start, s), true
+		}
+		for _, e := range o.next(s) {
+			c := cost[s] + 1
+			if known, seen := cost[e.to]; seen && known <= c {
+				continue
+			}
+			cost[e.to] = c
+			prev[e.to] = edge{s, e.move}
+			heap.Push(open, scored{e.to, c + h(e.to.cell)})
+		}
+	}
+	return nil, false
+}
+
+// heuristic never overestimates: a route is either straight Manhattan
+// distance or walks to some portal, jumps and walks from some portal exit
+func heuristic(m *model.Model, to *model.Cell, o Options) func(*model.Cell) int {
+	var entries []*model.Cell
+	exitToGoal := -1
+	if o.Portals {
+		for _, column := range m.Matrix {
+			for _, cell := range column {
+				if cell.Portal == nil {
+					continue
+				}
+				entries = append(entries, cell)
+				if d := manhattan(cell.Portal.Target, to); exitToGoal < 0 || d < exitToGoal {
+					exitToGoal = d
+				}
+			}
+		}
+	}
+	return func(c *model.Cell) int {
+		best := manhattan(c, to)
+		for _, p := range entries {
+			if d := manhattan(c, p) + 1 + exitToGoal; d < best {
+				best = d
+			}
+		}
+		return best
+	}
+}
+
+func manhattan(a, b *model.Cell) int {
+	return abs(a.Col-b.Col) + abs(a.Row-b.Row)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+type scored struct {
+	state
+	f int
+}
+
+// frontier is min heap of states by estimated total cost
+type frontier []scored
+
+func (f frontier) Len() int            { return len(f) }
+func (f frontier) Less(i, j int) bool  { return f[i].f < f[j].f }
+func (f frontier) Swap(i, j int)       { f[i], f[j] = f[j], f[i] }
+func (f *frontier) Push(x interface{}) { *f = append(*f, x.(scored)) }
+func (f *frontier) Pop() interface{} {
+	old := *f
+	x := old[len(old)-1]
+	*f = old[:len(old)-1]
+	return x
+}
+
+// Distances maps every reachable cell to the fewest moves to it
+func Distances(from *model.Cell, o Options) map[*model.Cell]int {
+	start := state{from, o.Keys}
+	dist := map[*model.Cell]int{}
+	depth := map[state]int{start: 0}
+	queue := []state{start}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		// breadth first, the first state reaching a cell is the nearest
+		if _, found := dist[s.cell]; !found {
+			dist[s.cell] = depth[s]
+		}
+		for _, e := range o.next(s) {
+			if _, seen := depth[e.to]; !seen {
+				depth[e.to] = depth[s] + 1
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return dist
+}
+
+// Reachable is the set of cells some route leads to, the start included
+func Reachable(from *model.Cell, o Options) map[*model.Cell]bool {
+	set := map[*model.Cell]bool{}
+	for cell := range Distances(from, o) {
+		set[cell] = true
+	}
+	return set
+}
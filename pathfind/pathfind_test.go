@@ -0,0 +1,244 @@
+package pathfind
+
+import (
+	"github.com/zucenko/roader/model"
+	"math/rand"
+	"testing"
+)
+
+// grid is open board without walls inside
+func grid(cols, rows int) *model.Model {
+	m := model.NewEmptyModel(cols, rows, map[int32]model.Player{})
+	for _, column := range m.Matrix {
+		for _, cell := range column {
+			for _, p := range cell.Paths {
+				p.Wall = p.Target == nil
+			}
+		}
+	}
+	return m
+}
+
+func wall(m *model.Model, col, row, d int, lock bool) {
+	p := m.Matrix[col][row].Paths[d]
+	p.Wall, p.Lock = true, lock
+	back := p.Target.Paths[(d+2)%4]
+	back.Wall, back.Lock = true, lock
+}
+
+func portal(m *model.Model, c1, r1, c2, r2 int) {
+	a, b := m.Matrix[c1][r1], m.Matrix[c2][r2]
+	a.Portal, b.Portal = &model.Portal{Target: b}, &model.Portal{Target: a}
+}
+
+// walk replays moves checking each is allowed, returns end cell
+func walk(t *testing.T, from *model.Cell, moves []int, o Options) *model.Cell {
+	t.Helper()
+	keys := o.Keys
+	cell := from
+	for i, d := range moves {
+		if d == MovePortal {
+			if !o.Portals || cell.Portal == nil {
+				t.Fatalf("move %d: no portal at %d,%d", i, cell.Col, cell.Row)
+			}
+			cell = cell.Portal.Target
+			continue
+		}
+		p := cell.Paths[d]
+		if p.Target == nil || p.Wall && !p.Lock {
+			t.Fatalf("move %d: wall at %d,%d dir %d", i, cell.Col, cell.Row, d)
+		}
+		if p.Wall {
+			if keys == 0 {
+				t.Fatalf("move %d: lock at %d,%d dir %d without key", i, cell.Col, cell.Row, d)
+			}
+			keys--
+		}
+		cell = p.Target
+	}
+	return cell
+}
+
+// search runs both algorithms, they must agree on the length
+func search(t *testing.T, m *model.Model, c1, r1, c2, r2 int, o Options) ([]int, bool) {
+	t.Helper()
+	from, to := m.Matrix[c1][r1], m.Matrix[c2][r2]
+	bfs, found := BFS(from, to, o)
+	astar, aFound := AStar(m, from, to, o)
+	if found != aFound || len(bfs) != len(astar) {
+		t.Fatalf("%d,%d -> %d,%d: BFS %v %v, A* %v %v", c1, r1, c2, r2, bfs, found, astar, aFound)
+	}
+	if found {
+		if end := walk(t, from, bfs, o); end != to {
+			t.Fatalf("BFS %v ends at %d,%d", bfs, end.Col, end.Row)
+		}
+		if end := walk(t, from, astar, o); end != to {
+			t.Fatalf("A* %v ends at %d,%d", astar, end.Col, end.Row)
+		}
+	}
+	return bfs, found
+}
+
+func TestOpenGrid(t *testing.T) {
+	m := grid(5, 4)
+	moves, found := search(t, m, 0, 0, 4, 3, Options{})
+	if !found || len(moves) != 7 {
+		t.Errorf("corner to corner %v", moves)
+	}
+	moves, found = search(t, m, 2, 2, 2, 2, Options{})
+	if !found || len(moves) != 0 || moves == nil {
+		t.Errorf("route to start %v %v", moves, found)
+	}
+}
+
+func TestWallDetour(t *testing.T) {
+	// 3x3 with wall column between col 0 and 1, open only at the bottom
+	m := grid(3, 3)
+	wall(m, 0, 0, 0, false)
+	wall(m, 0, 1, 0, false)
+	moves, found := search(t, m, 0, 0, 1, 0, Options{})
+	if !found || len(moves) != 5 {
+		t.Errorf("detour %v", moves)
+	}
+	wall(m, 0, 2, 0, false)
+	if _, found := search(t, m, 0, 0, 1, 0, Options{}); found {
+		t.Errorf("route through closed wall")
+	}
+}
+
+func TestLocks(t *testing.T) {
+	// corridor 4x1 with locks between 0-1 and 2-3
+	m := grid(4, 1)
+	wall(m, 0, 0, 0, true)
+	wall(m, 2, 0, 0, true)
+	for keys, reach := range []int{0, 2, 3, 3} {
+		o := Options{Keys: keys}
+		for col := 0; col < 4; col++ {
+			_, found := search(t, m, 0, 0, col, 0, o)
+			if found != (col <= reach) {
+				t.Errorf("%d keys: col %d found %v", keys, col, found)
+			}
+		}
+	}
+	if r := Reachable(m.Matrix[0][0], Options{Keys: 1}); len(r) != 3 || r[m.Matrix[3][0]] {
+		t.Errorf("reachable with 1 key %v", r)
+	}
+}
+
+func TestLockOrDetour(t *testing.T) {
+	// lock is the shortcut, without key the route goes around
+	m := grid(3, 2)
+	wall(m, 0, 0, 0, true)
+	moves, _ := search(t, m, 0, 0, 1, 0, Options{})
+	if len(moves) != 3 {
+		t.Errorf("without key %v", moves)
+	}
+	moves, _ = search(t, m, 0, 0, 1, 0, Options{Keys: 1})
+	if len(moves) != 1 || moves[0] != 0 {
+		t.Errorf("with key %v", moves)
+	}
+}
+
+func TestPortals(t *testing.T) {
+	m := grid(10, 1)
+	portal(m, 1, 0, 8, 0)
+	moves, _ := search(t, m, 0, 0, 9, 0, Options{})
+	if len(moves) != 9 {
+		t.Errorf("without portals %v", moves)
+	}
+	moves, _ = search(t, m, 0, 0, 9, 0, Options{Portals: true})
+	if len(moves) != 3 || moves[1] != MovePortal {
+		t.Errorf("with portals %v", moves)
+	}
+
+	// portal is the only way to closed room
+	wall(m, 4, 0, 0, false)
+	if _, found := search(t, m, 0, 0, 5, 0, Options{}); found {
+		t.Errorf("into closed room without portals")
+	}
+	if moves, found := search(t, m, 0, 0, 5, 0, Options{Portals: true}); !found || len(moves) != 5 {
+		t.Errorf("into closed room %v", moves)
+	}
+}
+
+func TestEnterLeave(t *testing.T) {
+	m := grid(3, 3)
+	blocked := m.Matrix[1][0]
+	o := Options{CanEnter: func(c *model.Cell) bool { return c != blocked }}
+	if moves, _ := search(t, m, 0, 0, 2, 0, o); len(moves) != 4 {
+		t.Errorf("around blocked cell %v", moves)
+	}
+	if _, found := search(t, m, 0, 0, 1, 0, o); found {
+		t.Errorf("into blocked cell")
+	}
+
+	// only the top row is known, cells below may be entered but not left
+	known := func(c *model.Cell) bool { return c.Row == 0 }
+	o = Options{CanLeave: known}
+	if _, found := search(t, m, 0, 0, 2, 1, o); !found {
+		t.Errorf("to unknown cell next to known one")
+	}
+	if _, found := search(t, m, 0, 0, 1, 2, o); found {
+		t.Errorf("across unknown cells")
+	}
+}
+
+func TestDistances(t *testing.T) {
+	m := grid(4, 3)
+	wall(m, 1, 0, 1, false)
+	wall(m, 1, 1, 0, true)
+	portal(m, 0, 0, 3, 2)
+	for _, o := range []Options{{}, {Keys: 1}, {Portals: true}, {Keys: 1, Portals: true}} {
+		dist := Distances(m.Matrix[0][0], o)
+		if len(dist) != 12 || dist[m.Matrix[0][0]] != 0 {
+			t.Fatalf("%+v distances %v", o, dist)
+		}
+		for cell, d := range dist {
+			moves, _ := search(t, m, 0, 0, cell.Col, cell.Row, o)
+			if len(moves) != d {
+				t.Errorf("%+v %d,%d distance %d, route %v", o, cell.Col, cell.Row, d, moves)
+			}
+		}
+	}
+	if d := Distances(m.Matrix[0][0], Options{Portals: true})[m.Matrix[3][2]]; d != 1 {
+		t.Errorf("portal exit distance %d", d)
+	}
+}
+
+func TestRandomBoards(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	for b := 0; b < 20; b++ {
+		cols, rows := 3+rnd.Intn(8), 3+rnd.Intn(6)
+		m := grid(cols, rows)
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				for _, d := range []int{0, 1} {
+					if m.Matrix[c][r].Paths[d].Target != nil && rnd.Intn(3) == 0 {
+						wall(m, c, r, d, rnd.Intn(3) == 0)
+					}
+				}
+			}
+		}
+		for i := 0; i < 2; i++ {
+			c1, r1, c2, r2 := rnd.Intn(cols), rnd.Intn(rows), rnd.Intn(cols), rnd.Intn(rows)
+			if m.Matrix[c1][r1].Portal == nil && m.Matrix[c2][r2].Portal == nil && (c1 != c2 || r1 != r2) {
+				portal(m, c1, r1, c2, r2)
+			}
+		}
+		o := Options{Keys: rnd.Intn(3), Portals: rnd.Intn(2) == 0}
+		from := m.Matrix[rnd.Intn(cols)][rnd.Intn(rows)]
+		dist := Distances(from, o)
+		reach := Reachable(from, o)
+		for c := 0; c < cols; c++ {
+			for r := 0; r < rows; r++ {
+				cell := m.Matrix[c][r]
+				moves, found := search(t, m, from.Col, from.Row, c, r, o)
+				d, inDist := dist[cell]
+				if found != inDist || found != reach[cell] || found && len(moves) != d {
+					t.Fatalf("board %d %+v to %d,%d: route %v %v, distance %d %v, reachable %v",
+						b, o, c, r, moves, found, d, inDist, reach[cell])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"github.com/zucenko/roaderclient/client"
+	"image/color"
+	"log"
+	"time"
+)
+
+const (
+	seekStep       = 5 * time.Second
+	playbackBarTop = 16
+)
+
+// replay plays recorded session, `roaderclient replay replays/roader-....rpl`
+func replay(args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: replay <file" + client.ReplayExt + ">")
+	}
+	header, entries, err := client.ReadReplay(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("replay of %s as %q started %v, %d messages", header.Host, header.Player, header.Started, len(entries))
+	cfg := client.DefaultConfig()
+	cfg.Spectate = header.Spectate
+	gs := client.NewGameSession(cfg)
+	play.GameSession = gs
+	play.Playback = client.NewPlayback(gs, header, entries)
+	if err := ebiten.Run(play.update, screenWidth, screenHeight, 1, "Roader replay"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// updatePlayback handles replay controls and feeds messages due this frame
+func (play *Play) updatePlayback() {
+	pb := play.Playback
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		pb.Paused = !pb.Paused
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		pb.Faster()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		pb.Slower()
+	}
+	if repeatingKeyPressed(ebiten.KeyPeriod) {
+		pb.Step()
+	}
+	if repeatingKeyPressed(ebiten.KeyLeft) {
+		pb.Seek(pb.Position() - seekStep)
+	}
+	if repeatingKeyPressed(ebiten.KeyRight) {
+		pb.Seek(pb.Position() + seekStep)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyHome) {
+		pb.Seek(0)
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		if y >= screenHeight-playbackBarTop {
+			pb.Seek(time.Duration(float64(pb.Duration()) * float64(x) / float64(screenWidth)))
+		}
+	}
+	pb.Advance(time.Second / time.Duration(ebiten.MaxTPS()))
+}
+
+func (play *Play) drawPlayback(screen *ebiten.Image) {
+	pb := play.Playback
+	top := float64(screenHeight - playbackBarTop)
+	ebitenutil.DrawRect(screen, 0, top, float64(screenWidth), playbackBarTop, color.RGBA{0x22, 0x22, 0x22, 0xff})
+	if d := pb.Duration(); d > 0 {
+		done := float64(screenWidth) * float64(pb.Position()) / float64(d)
+		ebitenutil.DrawRect(screen, 0, top, done, playbackBarTop, color.RGBA{0x1f, 0xc4, 0xff, 0x80})
+	}
+	state := "PLAY"
+	switch {
+	case pb.Ended():
+		state = "END"
+	case pb.Paused:
+		state = "PAUSED"
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s %vx %s / %s", state, pb.Speed,
+		formatClock(pb.Position()), formatClock(pb.Duration())), 4, int(top))
+	ebitenutil.DebugPrintAt(screen, "space pause  up/down speed  . step  left/right/home/click seek", 4, 4)
+}
+
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
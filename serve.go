@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roaderclient/server"
+	"strings"
+)
+
+// serve runs local stand-in server, `roaderclient serve -addr :8080`
+func serve(args []string) {
+	maze := server.DefaultMazeConfig()
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	players := fs.String("players", "A", "player letters, one game starts when all joined")
+	seed := fs.Int64("seed", 0, "maze seed, 0 for random")
+	fs.IntVar(&maze.Cols, "cols", maze.Cols, "maze columns")
+	fs.IntVar(&maze.Rows, "rows", maze.Rows, "maze rows")
+	fs.IntVar(&maze.Diamonds, "diamonds", maze.Diamonds, "diamonds in maze")
+	fs.IntVar(&maze.Keys, "keys", maze.Keys, "keys in maze")
+	fs.IntVar(&maze.Locks, "locks", maze.Locks, "locked walls in maze")
+	fs.IntVar(&maze.Portals, "portals", maze.Portals, "portal pairs in maze")
+	fs.Parse(args)
+
+	maze.Players = nil
+	for _, r := range strings.ToUpper(*players) {
+		maze.Players = append(maze.Players, int32(r))
+	}
+	if err := server.NewServer(maze, *seed).ListenAndServe(*addr); err != nil {
+		log.Fatal(err)
+	}
+}
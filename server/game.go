@@ -0,0 +1,364 @@
+package server
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/client"
+	"sync"
+)
+
+// Game is one match, players join until every slot of the maze is taken.
+// Every game is a lobby room, those created in lobby have Code and are
+// joined only by id or invite code.
+type Game struct {
+	Id      string
+	Name    string
+	Code    string
+	Private bool
+
+	mu       sync.Mutex
+	Model    *model.Model
+	sessions map[int32]*PlayerSession
+	// assigned players, they may be disconnected and resume later
+	assigned   map[int32]bool
+	spectators map[*PlayerSession]bool
+	started    bool
+}
+
+func NewGame(m *model.Model) *Game {
+	return &Game{
+		Model:      m,
+		sessions:   make(map[int32]*PlayerSession),
+		assigned:   make(map[int32]bool),
+		spectators: make(map[*PlayerSession]bool),
+	}
+}
+
+// join attaches session to requested player, 0 takes first free one.
+// Session resuming assigned player replaces the one still attached, its
+// connection probably dropped without us noticing.
+// Returns false when the player is not available in this game.
+func (g *Game) join(ps *PlayerSession, requested int32) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := g.available(requested)
+	if id == 0 {
+		return false
+	}
+	resumed := g.assigned[id]
+	if old := g.sessions[id]; old != nil {
+		log.Printf("Game.join player %c replaces its old connection", id)
+		old.close()
+	}
+	g.assigned[id] = true
+	g.sessions[id] = ps
+	ps.Id = id
+	ps.game = g
+
+	if g.started {
+		ps.sendFrame(g.setupMessage(id))
+		// resumed player may come back under another name
+		names := client.ServerFrame{Names: g.names()}
+		for pid, s := range g.sessions {
+			if pid != id {
+				s.sendFrame(names)
+			}
+		}
+		for s := range g.spectators {
+			s.sendFrame(names)
+		}
+	} else if len(g.assigned) == len(g.Model.PlayerKeys) {
+		g.started = true
+		for pid, s := range g.sessions {
+			s.sendFrame(g.setupMessage(pid))
+		}
+		for s := range g.spectators {
+			s.sendFrame(g.spectatorSetup())
+		}
+	}
+	log.Printf("Game.join player %c resumed:%v started:%v", id, resumed, g.started)
+	return true
+}
+
+// available returns player the session may take or 0. Players never assigned
+// can be taken before the game starts, assigned ones only resumed, even
+// while the old session is attached.
+func (g *Game) available(requested int32) int32 {
+	if requested == 0 {
+		if g.started {
+			return 0
+		}
+		for _, key := range g.Model.PlayerKeys {
+			if !g.assigned[key] {
+				return key
+			}
+		}
+		return 0
+	}
+	if _, found := g.Model.Players[requested]; !found {
+		return 0
+	}
+	if g.started && !g.assigned[requested] {
+		return 0
+	}
+	return requested
+}
+
+func (g *Game) free(requested int32) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.available(requested) != 0
+}
+
+// watch attaches read-only session, it gets the whole board once the game starts
+func (g *Game) watch(ps *PlayerSession) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.spectators[ps] = true
+	ps.game = g
+	if g.started {
+		ps.sendFrame(g.spectatorSetup())
+	}
+	log.Printf("Game.watch started:%v", g.started)
+}
+
+func (g *Game) leave(ps *PlayerSession) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.spectators, ps)
+	if g.sessions[ps.Id] == ps {
+		delete(g.sessions, ps.Id)
+	}
+}
+
+// room describes game for lobby, without invite code
+func (g *Game) room() client.Room {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r := client.Room{
+		Id:      g.Id,
+		Name:    g.Name,
+		Private: g.Private,
+		Cols:    len(g.Model.Matrix),
+		Rows:    len(g.Model.Matrix[0]),
+		Players: len(g.Model.PlayerKeys),
+		Started: g.started,
+	}
+	for _, key := range g.Model.PlayerKeys {
+		if g.sessions[key] != nil {
+			r.Waiting = append(r.Waiting, key)
+		}
+	}
+	r.Names = g.names()
+	return r
+}
+
+// extensions the stand-in server supports on top of the model protocol
+var extensions = []string{client.EXT_CHAT, client.EXT_NAMES}
+
+// names of connected players who have one
+func (g *Game) names() map[int32]string {
+	names := make(map[int32]string)
+	for id, s := range g.sessions {
+		if s.Name != "" {
+			names[id] = s.Name
+		}
+	}
+	return names
+}
+
+func (g *Game) setupMessage(id int32) client.ServerFrame {
+	players := make(map[int32]model.Player)
+	for pid, p := range g.Model.Players {
+		players[pid] = *p
+	}
+	p := g.Model.Players[id]
+	return client.ServerFrame{
+		Setup: []model.Setup{{
+			Cols:      len(g.Model.Matrix),
+			Rows:      len(g.Model.Matrix[0]),
+			PlayerKey: id,
+			Players:   players,
+		}},
+		Visibles:   visibles(g.Model.Matrix[p.Col][p.Row]),
+		Picks:      []model.Pick{{Keys: p.Keys, Diamonds: p.Diamonds}},
+		Extensions: extensions,
+		Names:      g.names(),
+	}
+}
+
+// spectatorSetup has no player key and reveals every cell
+func (g *Game) spectatorSetup() client.ServerFrame {
+	players := make(map[int32]model.Player)
+	for pid, p := range g.Model.Players {
+		players[pid] = *p
+	}
+	sm := client.ServerFrame{
+		Setup: []model.Setup{{
+			Cols:    len(g.Model.Matrix),
+			Rows:    len(g.Model.Matrix[0]),
+			Players: players,
+		}},
+		Extensions: extensions,
+		Names:      g.names(),
+	}
+	for _, column := range g.Model.Matrix {
+		for _, cell := range column {
+			sm.Visibles = append(sm.Visibles, visibilize(cell))
+		}
+	}
+	return sm
+}
+
+// Move applies player request and sends replies to all players
+func (g *Game) Move(id int32, d int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.started {
+		return
+	}
+	player := g.Model.Players[id]
+	picked, success := move(g.Model, player, d)
+	ds := []model.DirectionSuccess{{
+		Direction: d,
+		Col:       player.Col,
+		Row:       player.Row,
+		Success:   success,
+		PlayerKey: id,
+	}}
+	if !success {
+		if s := g.sessions[id]; s != nil {
+			s.send(model.ServerMessage{Directions: ds})
+		}
+		return
+	}
+	mine := model.ServerMessage{
+		Directions: ds,
+		Visibles:   visibles(g.Model.Matrix[player.Col][player.Row]),
+	}
+	if picked {
+		mine.Picks = []model.Pick{{Keys: player.Keys, Diamonds: player.Diamonds}}
+	}
+	for pid, s := range g.sessions {
+		if pid == id {
+			s.send(mine)
+		} else {
+			s.send(model.ServerMessage{Directions: ds})
+		}
+	}
+	for s := range g.spectators {
+		s.send(model.ServerMessage{Directions: ds})
+	}
+}
+
+// Chat relays message to everyone in the game including its author
+func (g *Game) Chat(id int32, text string) {
+	if len(text) > client.MaxChatText {
+		text = text[:client.MaxChatText]
+	}
+	f := client.ServerFrame{Chat: []client.ChatMessage{{From: id, Text: text}}}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.sessions {
+		s.sendFrame(f)
+	}
+	for s := range g.spectators {
+		s.sendFrame(f)
+	}
+}
+
+// move is the game rule, returns whether key or diamond count changed
+func move(m *model.Model, player *model.Player, d int) (picked bool, success bool) {
+	cell := m.Matrix[player.Col][player.Row]
+	var target *model.Cell
+	if d == 4 {
+		if cell.Portal == nil || cell.Portal.Target.Player != nil {
+			return false, false
+		}
+		target = cell.Portal.Target
+	} else {
+		if d < 0 || d > 3 {
+			return false, false
+		}
+		path := cell.Paths[d]
+		if path.Target == nil || path.Target.Player != nil {
+			return false, false
+		}
+		if path.Wall && !(path.Lock && player.Keys > 0) {
+			return false, false
+		}
+		if path.Wall {
+			player.Keys--
+			picked = true
+			setWall(cell, d, false, false)
+		}
+		target = path.Target
+		path.Player = player
+		target.Paths[(d+2)%4].Player = player
+	}
+	cell.Player = nil
+	target.Player = player
+	player.Col, player.Row = target.Col, target.Row
+	if target.Diamond {
+		target.Diamond = false
+		player.Diamonds++
+		picked = true
+	}
+	if target.Key {
+		target.Key = false
+		player.Keys++
+		picked = true
+	}
+	return picked, true
+}
+
+// visibles is the cell, cells reachable by open paths and the next cell
+// straight behind them, plus portal exits
+func visibles(cell *model.Cell) []model.Visibilize {
+	seen := map[*model.Cell]bool{}
+	var out []model.Visibilize
+	add := func(c *model.Cell) {
+		if c == nil || seen[c] {
+			return
+		}
+		seen[c] = true
+		out = append(out, visibilize(c))
+		if c.Portal != nil && !seen[c.Portal.Target] {
+			seen[c.Portal.Target] = true
+			out = append(out, visibilize(c.Portal.Target))
+		}
+	}
+	add(cell)
+	for d, p := range cell.Paths {
+		if p.Wall || p.Target == nil {
+			continue
+		}
+		add(p.Target)
+		if far := p.Target.Paths[d]; !far.Wall {
+			add(far.Target)
+		}
+	}
+	return out
+}
+
+func visibilize(cell *model.Cell) model.Visibilize {
+	v := model.Visibilize{
+		Col:     cell.Col,
+		Row:     cell.Row,
+		Diamond: cell.Diamond,
+		Key:     cell.Key,
+	}
+	for _, p := range cell.Paths {
+		v.Walls = append(v.Walls, p.Wall)
+		v.Locks = append(v.Locks, p.Lock)
+	}
+	if cell.Portal != nil {
+		v.Portal = true
+		v.PortalToCol, v.PortalToRow = cell.Portal.Target.Col, cell.Portal.Target.Row
+	}
+	if cell.Player != nil {
+		v.HasPlayer = true
+		v.PlayerId = cell.Player.Id
+	}
+	return v
+}
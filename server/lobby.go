@@ -0,0 +1,201 @@
+package server
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roaderclient/client"
+	"sync"
+)
+
+const (
+	maxRoomSide    = 40
+	maxRoomPlayers = 8
+)
+
+type lobbySession struct {
+	conn  client.Conn
+	codec client.Codec
+	out   chan client.LobbyMessage
+	done  chan struct{}
+	once  sync.Once
+}
+
+// send never blocks the server, lobby too slow to read is disconnected
+func (ls *lobbySession) send(lm client.LobbyMessage) {
+	select {
+	case ls.out <- lm:
+	case <-ls.done:
+	default:
+		log.Warnf("lobbySession too slow, disconnecting")
+		ls.close()
+	}
+}
+
+func (ls *lobbySession) close() {
+	ls.once.Do(func() {
+		close(ls.done)
+		ls.conn.Close()
+	})
+}
+
+func (ls *lobbySession) LoopChannelWrite() {
+	for {
+		select {
+		case lm := <-ls.out:
+			w, err := ls.conn.NextWriter(ls.codec.MessageType())
+			if err == nil {
+				err = ls.codec.Encode(w, lm)
+			}
+			if err == nil {
+				err = w.Close()
+			}
+			if err != nil {
+				log.Printf("lobbySession write %v", err)
+				ls.close()
+				return
+			}
+		case <-ls.done:
+			return
+		}
+	}
+}
+
+// ServeLobby answers LobbyRequests and pushes room list on every change
+func (s *Server) ServeLobby(conn client.Conn) {
+	ls := &lobbySession{
+		conn:  conn,
+		codec: codecFor(conn.Subprotocol()),
+		out:   make(chan client.LobbyMessage, sendBuffer),
+		done:  make(chan struct{}),
+	}
+	defer ls.close()
+	go ls.LoopChannelWrite()
+
+	s.mu.Lock()
+	s.lobbies[ls] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.lobbies, ls)
+		s.mu.Unlock()
+	}()
+	ls.send(client.LobbyMessage{Rooms: s.rooms()})
+
+	for {
+		_, r, err := conn.NextReader()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				log.Printf("lobbySession read %v", err)
+			}
+			return
+		}
+		req := client.LobbyRequest{}
+		if err := ls.codec.Decode(r, &req); err != nil {
+			log.Warnf("lobbySession decode %v", err)
+			return
+		}
+		ls.send(s.lobbyReply(req))
+	}
+}
+
+func (s *Server) lobbyReply(req client.LobbyRequest) client.LobbyMessage {
+	lm := client.LobbyMessage{ReplyTo: req.Id}
+	switch {
+	case req.List:
+		lm.Rooms = s.rooms()
+	case req.Create != nil:
+		room, err := s.createRoom(*req.Create)
+		if err != nil {
+			lm.Err = err.Error()
+			break
+		}
+		lm.Room = &room
+		s.broadcast()
+	case req.Code != "":
+		room, found := s.findRoom(req.Code)
+		if !found {
+			lm.Err = fmt.Sprintf("no room with invite %q", req.Code)
+			break
+		}
+		lm.Room = &room
+	default:
+		lm.Err = "empty request"
+	}
+	return lm
+}
+
+func (s *Server) createRoom(settings client.RoomSettings) (client.Room, error) {
+	if settings.Cols < 2 || settings.Rows < 2 || settings.Cols > maxRoomSide || settings.Rows > maxRoomSide {
+		return client.Room{}, fmt.Errorf("room size %dx%d out of 2..%d", settings.Cols, settings.Rows, maxRoomSide)
+	}
+	if settings.Players < 1 || settings.Players > maxRoomPlayers {
+		return client.Room{}, fmt.Errorf("%d players out of 1..%d", settings.Players, maxRoomPlayers)
+	}
+	maze := s.Maze
+	maze.Cols, maze.Rows = settings.Cols, settings.Rows
+	maze.Players = nil
+	for i := 0; i < settings.Players; i++ {
+		maze.Players = append(maze.Players, int32('A'+i))
+	}
+
+	s.mu.Lock()
+	g := s.newGame(maze)
+	g.Name = settings.Name
+	g.Private = settings.Private
+	g.Code = s.inviteCode()
+	s.mu.Unlock()
+
+	room := g.room()
+	room.Code = g.Code
+	return room, nil
+}
+
+// inviteCode is unused six digit code, s.mu is held
+func (s *Server) inviteCode() string {
+	for {
+		code := fmt.Sprintf("%06d", s.rnd.Intn(1000000))
+		used := false
+		for _, g := range s.games {
+			used = used || g.Code == code
+		}
+		if !used {
+			return code
+		}
+	}
+}
+
+func (s *Server) findRoom(code string) (client.Room, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.games {
+		if g.Code == code {
+			room := g.room()
+			room.Code = code
+			return room, true
+		}
+	}
+	return client.Room{}, false
+}
+
+// rooms lists public rooms, never nil so empty list still reaches clients
+func (s *Server) rooms() []client.Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rooms := []client.Room{}
+	for _, g := range s.games {
+		if !g.Private {
+			rooms = append(rooms, g.room())
+		}
+	}
+	return rooms
+}
+
+func (s *Server) broadcast() {
+	lm := client.LobbyMessage{Rooms: s.rooms()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ls := range s.lobbies {
+		ls.send(lm)
+	}
+}
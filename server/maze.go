@@ -0,0 +1,184 @@
+package server
+
+import (
+	"github.com/zucenko/roader/model"
+	"math/rand"
+)
+
+// MazeConfig says what Generate puts into the maze
+type MazeConfig struct {
+	Cols, Rows int
+	Players    []int32
+	Diamonds   int
+	Keys       int
+	Locks      int
+	Portals    int
+	// Loops is how many extra walls are removed so the maze is not a tree
+	Loops int
+}
+
+func DefaultMazeConfig() MazeConfig {
+	return MazeConfig{
+		Cols:     20,
+		Rows:     13,
+		Players:  []int32{'A'},
+		Diamonds: 12,
+		Keys:     4,
+		Locks:    6,
+		Portals:  2,
+		Loops:    25,
+	}
+}
+
+// Generate carves random maze with depth first search, then opens loops,
+// turns some remaining walls into locks and scatters keys, diamonds, portals
+// and players over distinct cells.
+func Generate(cfg MazeConfig, rnd *rand.Rand) *model.Model {
+	matrix := make([][]*model.Cell, cfg.Cols)
+	for c := range matrix {
+		matrix[c] = make([]*model.Cell, cfg.Rows)
+		for r := range matrix[c] {
+			matrix[c][r] = &model.Cell{Col: c, Row: r}
+		}
+	}
+	for c := 0; c < cfg.Cols; c++ {
+		for r := 0; r < cfg.Rows; r++ {
+			cell := matrix[c][r]
+			for d := 0; d < 4; d++ {
+				cell.Paths[d] = &model.Path{Dir: d, Wall: true, Target: neighbour(matrix, cell, d)}
+			}
+		}
+	}
+
+	// carve
+	visited := map[*model.Cell]bool{matrix[0][0]: true}
+	stack := []*model.Cell{matrix[0][0]}
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		var dirs []int
+		for d := 0; d < 4; d++ {
+			if t := cell.Paths[d].Target; t != nil && !visited[t] {
+				dirs = append(dirs, d)
+			}
+		}
+		if len(dirs) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		d := dirs[rnd.Intn(len(dirs))]
+		setWall(cell, d, false, false)
+		next := cell.Paths[d].Target
+		visited[next] = true
+		stack = append(stack, next)
+	}
+
+	inner := innerWalls(matrix)
+	rnd.Shuffle(len(inner), func(i, j int) { inner[i], inner[j] = inner[j], inner[i] })
+	for i := 0; i < cfg.Loops && len(inner) > 0; i++ {
+		setWall(inner[0].cell, inner[0].dir, false, false)
+		inner = inner[1:]
+	}
+	for i := 0; i < cfg.Locks && len(inner) > 0; i++ {
+		setWall(inner[0].cell, inner[0].dir, true, true)
+		inner = inner[1:]
+	}
+
+	free := make([]*model.Cell, 0, cfg.Cols*cfg.Rows)
+	for _, column := range matrix {
+		free = append(free, column...)
+	}
+	rnd.Shuffle(len(free), func(i, j int) { free[i], free[j] = free[j], free[i] })
+	take := func() *model.Cell {
+		if len(free) == 0 {
+			return nil
+		}
+		cell := free[0]
+		free = free[1:]
+		return cell
+	}
+
+	players := make(map[int32]*model.Player)
+	for _, id := range cfg.Players {
+		cell := take()
+		if cell == nil {
+			break
+		}
+		p := &model.Player{Id: id, Col: cell.Col, Row: cell.Row}
+		players[id] = p
+		cell.Player = p
+	}
+	for i := 0; i < cfg.Portals; i++ {
+		a, b := take(), take()
+		if a == nil || b == nil {
+			break
+		}
+		a.Portal = &model.Portal{Target: b}
+		b.Portal = &model.Portal{Target: a}
+	}
+	for i := 0; i < cfg.Keys; i++ {
+		if cell := take(); cell != nil {
+			cell.Key = true
+		}
+	}
+	for i := 0; i < cfg.Diamonds; i++ {
+		if cell := take(); cell != nil {
+			cell.Diamond = true
+		}
+	}
+
+	keys := make([]int32, 0, len(players))
+	for _, id := range cfg.Players {
+		if _, found := players[id]; found {
+			keys = append(keys, id)
+		}
+	}
+	return &model.Model{Matrix: matrix, Players: players, PlayerKeys: keys}
+}
+
+func neighbour(matrix [][]*model.Cell, cell *model.Cell, d int) *model.Cell {
+	c, r := cell.Col, cell.Row
+	switch d {
+	case 0:
+		c++
+	case 1:
+		r++
+	case 2:
+		c--
+	case 3:
+		r--
+	}
+	if c < 0 || r < 0 || c >= len(matrix) || r >= len(matrix[0]) {
+		return nil
+	}
+	return matrix[c][r]
+}
+
+// setWall keeps both sides of the wall in sync
+func setWall(cell *model.Cell, d int, wall, lock bool) {
+	p := cell.Paths[d]
+	p.Wall, p.Lock = wall, lock
+	if p.Target != nil {
+		back := p.Target.Paths[(d+2)%4]
+		back.Wall, back.Lock = wall, lock
+	}
+}
+
+type wallRef struct {
+	cell *model.Cell
+	dir  int
+}
+
+// innerWalls lists every standing wall between two cells once
+func innerWalls(matrix [][]*model.Cell) []wallRef {
+	var walls []wallRef
+	for _, column := range matrix {
+		for _, cell := range column {
+			for _, d := range []int{0, 1} {
+				if p := cell.Paths[d]; p.Wall && p.Target != nil {
+					walls = append(walls, wallRef{cell, d})
+				}
+			}
+		}
+	}
+	return walls
+}
@@ -0,0 +1,339 @@
+// Package server is local stand-in for the roader game server, speaking the
+// same ServerMessage/ClientMessage protocol on /play. It is meant for offline
+// development and tests, not for real matches.
+package server
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/client"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	URI_WS    = "/play"
+	URI_LOBBY = "/lobby"
+)
+
+const sendBuffer = 256
+
+type Server struct {
+	Maze MazeConfig
+	// Seed of maze generator, 0 picks time based one
+	Seed     int64
+	Upgrader *websocket.Upgrader
+	// Tokens maps auth tokens to player names, nil lets anyone in under
+	// the name they ask for
+	Tokens map[string]string
+
+	mu       sync.Mutex
+	rnd      *rand.Rand
+	games    []*Game
+	lobbies  map[*lobbySession]bool
+	lastRoom int
+}
+
+func NewServer(maze MazeConfig, seed int64) *Server {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	subprotocols := []string{}
+	for _, name := range []string{"gob", "json", "binary"} {
+		codec := client.Codecs[name]
+		if sc, ok := codec.(client.StreamCodec); ok {
+			subprotocols = append(subprotocols, sc.StreamSubprotocol())
+		}
+		subprotocols = append(subprotocols, client.Subprotocol(codec))
+	}
+	return &Server{
+		Maze:     maze,
+		Seed:     seed,
+		Upgrader: &websocket.Upgrader{Subprotocols: subprotocols},
+		rnd:      rand.New(rand.NewSource(seed)),
+		lobbies:  make(map[*lobbySession]bool),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	upgrade := func(w http.ResponseWriter, r *http.Request) {
+		name, ok := s.authorize(*r.URL, r.Header)
+		if !ok {
+			http.Error(w, "bad token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := s.Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Printf("Server upgrade %v", err)
+			return
+		}
+		s.route(conn, *r.URL, name)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(URI_WS, upgrade)
+	mux.HandleFunc(URI_LOBBY, upgrade)
+	return mux
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("Server listening on %s%s", addr, URI_WS)
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// ServePipe serves connections dialed through in-memory transport until ctx ends
+func (s *Server) ServePipe(ctx context.Context, t *client.PipeTransport) {
+	for {
+		select {
+		case conn := <-t.Accept():
+			name, ok := s.authorize(conn.URL, conn.Header)
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "bad token"),
+					time.Now().Add(time.Second))
+				conn.Close()
+				continue
+			}
+			go s.route(conn, conn.URL, name)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// authorize checks bearer token and returns name the player goes by
+func (s *Server) authorize(u url.URL, header http.Header) (string, bool) {
+	name := u.Query().Get("name")
+	if s.Tokens == nil {
+		return name, true
+	}
+	token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	name, found := s.Tokens[token]
+	return name, found && token != ""
+}
+
+func (s *Server) route(conn client.Conn, u url.URL, name string) {
+	if u.Path == URI_LOBBY {
+		s.ServeLobby(conn)
+	} else {
+		s.Serve(conn, u, name)
+	}
+}
+
+// Serve runs one player connection until it breaks
+func (s *Server) Serve(conn client.Conn, u url.URL, name string) {
+	defer conn.Close()
+	codec := codecFor(conn.Subprotocol())
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > client.MaxNameLength {
+		name = string(runes[:client.MaxNameLength])
+	}
+	ps := &PlayerSession{
+		Name:  name,
+		Conn:  conn,
+		codec: codec,
+		out:   make(chan client.ServerFrame, sendBuffer),
+		done:  make(chan struct{}),
+	}
+	if u.Query().Get("spectate") != "" {
+		if !s.watch(ps, u.Query().Get("room"), u.Query().Get("invite")) {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "no such room"),
+				time.Now().Add(time.Second))
+			return
+		}
+	} else if !s.play(ps, u) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "player not available"),
+			time.Now().Add(time.Second))
+		return
+	}
+	s.broadcast()
+	defer s.broadcast()
+	defer ps.game.leave(ps)
+
+	go ps.LoopChannelWrite()
+	ps.LoopChannelRead()
+	ps.close()
+}
+
+// play joins session as player requested in query, any free one without it
+func (s *Server) play(ps *PlayerSession, u url.URL) bool {
+	requested := int32(0)
+	if p := u.Query().Get("player"); p != "" {
+		key, err := strconv.Atoi(p)
+		if err != nil {
+			log.Warnf("Server bad player %q", p)
+			return false
+		}
+		requested = int32(key)
+	}
+	var joined bool
+	if id, code := u.Query().Get("room"), u.Query().Get("invite"); id != "" || code != "" {
+		joined = s.joinRoom(ps, id, code, requested)
+	} else {
+		joined = s.join(ps, requested)
+	}
+	if !joined {
+		log.Warnf("Server player %c not available", requested)
+	}
+	return joined
+}
+
+// joinRoom joins lobby room given by id or invite code
+func (s *Server) joinRoom(ps *PlayerSession, id, code string, requested int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.games {
+		if id != "" && g.Id == id || code != "" && g.Code == code {
+			return g.join(ps, requested)
+		}
+	}
+	return false
+}
+
+// join matches player into any free game not created in lobby
+func (s *Server) join(ps *PlayerSession, requested int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.games {
+		if g.Code == "" && g.free(requested) {
+			return g.join(ps, requested)
+		}
+	}
+	if requested != 0 {
+		found := false
+		for _, id := range s.Maze.Players {
+			found = found || id == requested
+		}
+		if !found {
+			return false
+		}
+	}
+	return s.newGame(s.Maze).join(ps, requested)
+}
+
+// watch puts spectator into room given by id or invite code, without them
+// into the latest game, starting one when there is none
+func (s *Server) watch(ps *PlayerSession, id, code string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "" || code != "" {
+		for _, g := range s.games {
+			if id != "" && g.Id == id || code != "" && g.Code == code {
+				g.watch(ps)
+				return true
+			}
+		}
+		return false
+	}
+	if len(s.games) == 0 {
+		s.newGame(s.Maze)
+	}
+	s.games[len(s.games)-1].watch(ps)
+	return true
+}
+
+// newGame registers game as room with next id, s.mu is held
+func (s *Server) newGame(maze MazeConfig) *Game {
+	g := NewGame(Generate(maze, s.rnd))
+	s.lastRoom++
+	g.Id = strconv.Itoa(s.lastRoom)
+	s.games = append(s.games, g)
+	return g
+}
+
+func codecFor(subprotocol string) client.Codec {
+	name := strings.TrimPrefix(subprotocol, "roader.")
+	for _, codec := range client.Codecs {
+		if sc, ok := codec.(client.StreamCodec); ok && sc.StreamSubprotocol() == subprotocol {
+			return sc.NewStream()
+		}
+		if codec.Name() == name {
+			return codec
+		}
+	}
+	return client.GobCodec{}
+}
+
+type PlayerSession struct {
+	Id    int32
+	Name  string
+	Conn  client.Conn
+	game  *Game
+	codec client.Codec
+	out   chan client.ServerFrame
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (ps *PlayerSession) send(sm model.ServerMessage) {
+	ps.sendFrame(client.Frame(sm))
+}
+
+// sendFrame never blocks the game, client too slow to read is disconnected
+func (ps *PlayerSession) sendFrame(f client.ServerFrame) {
+	select {
+	case ps.out <- f:
+	case <-ps.done:
+	default:
+		log.Warnf("PlayerSession %c too slow, disconnecting", ps.Id)
+		ps.close()
+	}
+}
+
+func (ps *PlayerSession) close() {
+	ps.once.Do(func() {
+		close(ps.done)
+		ps.Conn.Close()
+	})
+}
+
+func (ps *PlayerSession) LoopChannelRead() {
+	for {
+		_, r, err := ps.Conn.NextReader()
+		if err != nil {
+			log.Printf("PlayerSession %c read %v", ps.Id, err)
+			return
+		}
+		cf := client.ClientFrame{}
+		if err := ps.codec.Decode(r, &cf); err != nil {
+			log.Warnf("PlayerSession %c decode %v", ps.Id, err)
+			return
+		}
+		if cf.Chat != nil {
+			ps.game.Chat(ps.Id, cf.Chat.Text)
+		}
+		if ps.Id != 0 && cf.Move != client.NoMove {
+			ps.game.Move(ps.Id, cf.Move)
+		}
+	}
+}
+
+func (ps *PlayerSession) LoopChannelWrite() {
+	for {
+		select {
+		case f := <-ps.out:
+			w, err := ps.Conn.NextWriter(ps.codec.MessageType())
+			if err == nil {
+				err = ps.codec.Encode(w, f)
+			}
+			if err == nil {
+				err = w.Close()
+			}
+			if err != nil {
+				log.Printf("PlayerSession %c write %v", ps.Id, err)
+				ps.close()
+				return
+			}
+		case <-ps.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package server
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/zucenko/roader/model"
+	"github.com/zucenko/roaderclient/client"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer is Server answering on in-memory transport
+type testServer struct {
+	*Server
+	t         *testing.T
+	ctx       context.Context
+	transport *client.PipeTransport
+}
+
+// startServer serves pipe transport until stop is called
+func startServer(t *testing.T, seed int64) (ts *testServer, stop func()) {
+	s := NewServer(DefaultMazeConfig(), seed)
+	ctx, cancel := context.WithCancel(context.Background())
+	ts = &testServer{
+		Server:    s,
+		t:         t,
+		ctx:       ctx,
+		transport: client.NewPipeTransport(s.Upgrader.Subprotocols...),
+	}
+	go s.ServePipe(ctx, ts.transport)
+	return ts, cancel
+}
+
+// connect starts session of cfg against the server
+func (ts *testServer) connect(cfg client.Config) *client.GameSession {
+	gs := client.NewGameSession(cfg)
+	gs.Transport = ts.transport
+	if err := gs.Connect(ts.ctx); err != nil {
+		ts.t.Fatal(err)
+	}
+	return gs
+}
+
+// waitFor runs Loop of sessions until done, failing the test after 2s
+func waitFor(t *testing.T, what string, done func() bool, sessions ...*client.GameSession) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		for _, gs := range sessions {
+			gs.Loop()
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGenerateConnected(t *testing.T) {
+	cfg := DefaultMazeConfig()
+	cfg.Locks = 0
+	m := Generate(cfg, rand.New(rand.NewSource(1)))
+	seen := map[*model.Cell]bool{m.Matrix[0][0]: true}
+	queue := []*model.Cell{m.Matrix[0][0]}
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+		for d, p := range cell.Paths {
+			if p.Target == nil {
+				if !p.Wall {
+					t.Fatalf("open border at %d,%d dir %d", cell.Col, cell.Row, d)
+				}
+				continue
+			}
+			if p.Wall != p.Target.Paths[(d+2)%4].Wall {
+				t.Fatalf("wall not symmetric at %d,%d dir %d", cell.Col, cell.Row, d)
+			}
+			if !p.Wall && !seen[p.Target] {
+				seen[p.Target] = true
+				queue = append(queue, p.Target)
+			}
+		}
+	}
+	if len(seen) != cfg.Cols*cfg.Rows {
+		t.Errorf("reached %d of %d cells", len(seen), cfg.Cols*cfg.Rows)
+	}
+}
+
+func TestSessionAgainstServer(t *testing.T) {
+	ts, stop := startServer(t, 1)
+	defer stop()
+	gs := ts.connect(client.DefaultConfig())
+	defer gs.Close()
+
+	waitFor(t, "setup", func() bool { return gs.Model != nil }, gs)
+	if gs.PlayerKey != 'A' {
+		t.Fatalf("player %c", gs.PlayerKey)
+	}
+
+	// move through first open path the server made visible
+	p := gs.Model.Players[gs.PlayerKey]
+	col, row := p.Col, p.Row
+	dir := -1
+	for d, path := range gs.Model.Matrix[col][row].Paths {
+		if path.Target != nil && !path.Wall {
+			dir = d
+			break
+		}
+	}
+	if dir < 0 {
+		t.Fatal("no open path around player")
+	}
+	gs.MessagesOut <- model.ClientMessage{Move: dir}
+	waitFor(t, "move", func() bool { return p.Col != col || p.Row != row }, gs)
+
+	col, row = p.Col, p.Row
+	if err := gs.Say("  hello  "); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "chat echo", func() bool { return len(gs.Chat.Lines()) == 1 }, gs)
+	if line := gs.Chat.Lines()[0]; line.From != 'A' || line.Text != "hello" {
+		t.Errorf("chat %+v", line)
+	}
+	if p.Col != col || p.Row != row {
+		t.Error("chat frame moved the player")
+	}
+}
+
+func TestSpectatorFollowsPlayer(t *testing.T) {
+	ts, stop := startServer(t, 2)
+	defer stop()
+	cfg := client.DefaultConfig()
+	cfg.Spectate = true
+	spectator := ts.connect(cfg)
+	defer spectator.Close()
+	player := ts.connect(client.DefaultConfig())
+	defer player.Close()
+	waitFor(t, "setup", func() bool { return spectator.Model != nil && player.Model != nil }, spectator, player)
+	if spectator.PlayerKey != 0 {
+		t.Fatalf("spectator got player %c", spectator.PlayerKey)
+	}
+
+	// spectator sees the whole board, the server's model is the truth
+	m := ts.games[0].Model
+	p := m.Players['A']
+	for c, column := range m.Matrix {
+		for r, cell := range column {
+			for d, path := range cell.Paths {
+				if spectator.Model.Matrix[c][r].Paths[d].Wall != path.Wall {
+					t.Fatalf("wall %d,%d dir %d differs", c, r, d)
+				}
+			}
+		}
+	}
+	dir := -1
+	for d, path := range m.Matrix[p.Col][p.Row].Paths {
+		if path.Target != nil && !path.Wall {
+			dir = d
+			break
+		}
+	}
+	target := m.Matrix[p.Col][p.Row].Paths[dir].Target
+	diamonds := p.Diamonds
+	if target.Diamond {
+		diamonds++
+	}
+	player.MessagesOut <- model.ClientMessage{Move: dir}
+	watched := spectator.Model.Players['A']
+	waitFor(t, "spectator sees move", func() bool {
+		return watched.Col == target.Col && watched.Row == target.Row
+	}, spectator, player)
+	if watched.Diamonds != diamonds {
+		t.Errorf("spectator counts %d diamonds, want %d", watched.Diamonds, diamonds)
+	}
+}
+
+func TestLobbyRooms(t *testing.T) {
+	ts, stop := startServer(t, 3)
+	defer stop()
+	ctx := ts.ctx
+
+	lobby, err := client.DialLobby(ctx, client.DefaultConfig(), ts.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lobby.Close()
+	if _, err := lobby.Create(ctx, client.RoomSettings{Cols: 1, Rows: 5, Players: 2}); err == nil {
+		t.Error("too small room created")
+	}
+	room, err := lobby.Create(ctx, client.RoomSettings{Name: "duel", Cols: 8, Rows: 6, Players: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := lobby.Create(ctx, client.RoomSettings{Cols: 5, Rows: 5, Players: 1, Private: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.Code == "" || room.Players != 2 || room.Cols != 8 {
+		t.Fatalf("created %+v", room)
+	}
+	rooms, err := lobby.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rooms) != 1 || rooms[0].Id != room.Id || rooms[0].Code != "" {
+		t.Fatalf("listed %+v", rooms)
+	}
+	if found, err := lobby.Find(ctx, secret.Code); err != nil || found.Id != secret.Id {
+		t.Fatalf("find private room %+v %v", found, err)
+	}
+
+	cfg := client.DefaultConfig()
+	cfg.Room = room.Id
+	first := ts.connect(cfg)
+	defer first.Close()
+	waitFor(t, "first player waiting", func() bool {
+		r, _ := lobby.Room(room.Id)
+		return len(r.Waiting) == 1
+	})
+
+	cfg = client.DefaultConfig()
+	cfg.Invite = room.Code
+	second := ts.connect(cfg)
+	defer second.Close()
+	waitFor(t, "setup", func() bool { return first.Model != nil && second.Model != nil }, first, second)
+	if len(first.Model.Matrix) != 8 || first.PlayerKey == second.PlayerKey {
+		t.Errorf("players %c %c in %d columns", first.PlayerKey, second.PlayerKey, len(first.Model.Matrix))
+	}
+	waitFor(t, "room started", func() bool {
+		r, _ := lobby.Room(room.Id)
+		return r.Started && len(r.Waiting) == 2
+	})
+}
+
+func TestNamesAndTokens(t *testing.T) {
+	ts, stop := startServer(t, 4)
+	defer stop()
+	ts.Tokens = map[string]string{"secret": "Alice"}
+
+	intruder := client.NewGameSession(client.DefaultConfig())
+	intruder.Transport = ts.transport
+	states := intruder.Subscribe()
+	if err := intruder.Connect(ts.ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer intruder.Close()
+	deadline := time.After(2 * time.Second)
+rejected:
+	for {
+		select {
+		case e := <-states:
+			if e.State == client.CS_RECONNECTING {
+				t.Fatalf("rejected session reconnects: %v", e.Err)
+			}
+			if e.State == client.CS_CLOSED {
+				if client.ErrorKindOf(e.Err) != client.ERR_REJECTED {
+					t.Fatalf("session closed with %v", e.Err)
+				}
+				break rejected
+			}
+		case <-deadline:
+			t.Fatal("session without token not rejected")
+		}
+	}
+	select {
+	case <-intruder.Done():
+	case <-deadline:
+		t.Fatal("rejected session not done")
+	}
+
+	cfg := client.DefaultConfig()
+	cfg.Name, cfg.Token = "Mallory", "secret"
+	gs := ts.connect(cfg)
+	defer gs.Close()
+	waitFor(t, "setup", func() bool { return gs.Model != nil }, gs)
+	if !gs.Supports(client.EXT_NAMES) || gs.Name(gs.PlayerKey) != "Alice" {
+		t.Errorf("player %c is %q", gs.PlayerKey, gs.Name(gs.PlayerKey))
+	}
+	if gs.Name('Z') != "Z" {
+		t.Errorf("unnamed player is %q", gs.Name('Z'))
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	s := NewServer(DefaultMazeConfig(), 5)
+	s.Tokens = map[string]string{"secret": "Alice"}
+	hs := httptest.NewServer(s.Handler())
+	defer hs.Close()
+
+	cfg := client.DefaultConfig()
+	cfg.Host = strings.TrimPrefix(hs.URL, "http://")
+	cfg.Token = "wrong"
+	gs := client.NewGameSession(cfg)
+	err := gs.Connect(context.Background())
+	if client.ErrorKindOf(err) != client.ERR_REJECTED {
+		t.Fatalf("connect with bad token: %v", err)
+	}
+	if gs.State() != client.CS_CLOSED {
+		t.Errorf("state %s", gs.State().Name())
+	}
+}
+
+func TestJoinStartedRoom(t *testing.T) {
+	ts, stop := startServer(t, 6)
+	defer stop()
+	lobby, err := client.DialLobby(ts.ctx, client.DefaultConfig(), ts.transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lobby.Close()
+	room, err := lobby.Create(ts.ctx, client.RoomSettings{Cols: 5, Rows: 5, Players: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := client.DefaultConfig()
+	cfg.Room = room.Id
+	first := ts.connect(cfg)
+	defer first.Close()
+	waitFor(t, "setup", func() bool { return first.Model != nil }, first)
+
+	for _, id := range []string{room.Id, "nope"} {
+		cfg.Room = id
+		late := ts.connect(cfg)
+		waitFor(t, "room "+id+" refused", func() bool { return late.State() == client.CS_CLOSED })
+		if client.ErrorKindOf(late.Err()) != client.ERR_REJECTED {
+			t.Errorf("room %s: session ended with %v", id, late.Err())
+		}
+		late.Close()
+	}
+}
+
+// lingering keeps connections open when the client closes them, as if the
+// network dropped without the server noticing
+type lingering struct {
+	*client.PipeTransport
+	conns chan client.Conn
+}
+
+type lingeringConn struct {
+	client.Conn
+}
+
+func (c lingeringConn) Close() error { return nil }
+
+func (t *lingering) Dial(ctx context.Context, u url.URL, header http.Header, subprotocols []string) (client.Conn, error) {
+	c, err := t.PipeTransport.Dial(ctx, u, header, subprotocols)
+	if err != nil {
+		return nil, err
+	}
+	t.conns <- c
+	return lingeringConn{c}, nil
+}
+
+func TestResumeReplacesDroppedConnection(t *testing.T) {
+	ts, stop := startServer(t, 7)
+	defer stop()
+	transport := &lingering{ts.transport, make(chan client.Conn, 2)}
+	gs := client.NewGameSession(client.DefaultConfig())
+	gs.Transport = transport
+	gs.Heartbeat.Interval = 0
+	gs.Backoff = client.Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1}
+	states := gs.Subscribe()
+	if err := gs.Connect(ts.ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer gs.Close()
+	waitFor(t, "setup", func() bool { return gs.Model != nil }, gs)
+	m := gs.Model
+	old := <-transport.conns
+	defer old.Close()
+
+	// client gives up on the connection, server end stays open
+	old.SetReadDeadline(time.Now())
+	var resumed *client.StateEvent
+	waitFor(t, "reconnect", func() bool {
+		select {
+		case e := <-states:
+			if e.State == client.CS_CLOSED {
+				t.Fatalf("resume ended session: %v", e.Err)
+			}
+			if e.State == client.CS_RECONNECTING {
+				resumed = &e
+			}
+			return resumed != nil && e.State == client.CS_CONNECTED
+		default:
+			return false
+		}
+	}, gs)
+	defer (<-transport.conns).Close()
+	if client.ErrorKindOf(resumed.Err) != client.ERR_TIMEOUT {
+		t.Errorf("reconnecting after %v", resumed.Err)
+	}
+	// replaced server session hangs up the old connection
+	waitFor(t, "old connection closed", func() bool {
+		return old.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)) != nil
+	}, gs)
+	time.Sleep(50 * time.Millisecond)
+	gs.Loop()
+	if gs.State() != client.CS_CONNECTED || gs.Model != m {
+		t.Errorf("session %s, model kept %v", gs.State().Name(), gs.Model == m)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+	"log"
+)
+
+// SettingsScreen edits Keymap over the board, changes are saved on close
+type SettingsScreen struct {
+	Selected Action
+	// Capturing waits for key to add to the selected action
+	Capturing bool
+	Status    string
+}
+
+// updateSettings returns true while the settings screen takes the keyboard
+func (play *Play) updateSettings() bool {
+	if play.Settings == nil {
+		if !play.Chat.Open && play.Keymap.Pressed(ACTION_SETTINGS) {
+			play.Settings = &SettingsScreen{}
+			return true
+		}
+		return false
+	}
+	s, k := play.Settings, play.Keymap
+	if s.Capturing {
+		for key := ebiten.Key(0); key <= ebiten.KeyMax; key++ {
+			if !inpututil.IsKeyJustPressed(key) {
+				continue
+			}
+			s.Capturing = false
+			s.Status = ""
+			if key != ebiten.KeyEscape && !k.Bind(s.Selected, key) {
+				s.Status = key.String() + " is the only key opening settings"
+			}
+			break
+		}
+		return true
+	}
+	b := k[s.Selected]
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape), play.Keymap.Pressed(ACTION_SETTINGS):
+		play.closeSettings()
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp) && s.Selected > 0:
+		s.Selected--
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown) && s.Selected < actionCount-1:
+		s.Selected++
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnter):
+		s.Capturing = true
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackspace), inpututil.IsKeyJustPressed(ebiten.KeyDelete):
+		k.Clear(s.Selected)
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight) && shift:
+		b.Interval++
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft) && shift && b.Interval > 1:
+		b.Interval--
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		b.Delay += 5
+		if b.Interval == 0 {
+			b.Interval = 3
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft) && b.Delay > 0:
+		b.Delay -= 5
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		play.Keymap = DefaultKeymap()
+	}
+	return true
+}
+
+func (play *Play) closeSettings() {
+	play.Settings = nil
+	if err := play.Keymap.Save(KeymapFile); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+func (play *Play) drawSettings(screen *ebiten.Image) {
+	s := play.Settings
+	y := 10
+	line := func(format string, args ...interface{}) {
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf(format, args...), 20, y)
+		y += 16
+	}
+	line("KEYS   up/down select, enter add key, backspace clear, home defaults, esc close")
+	line("       left/right repeat delay, shift+left/right repeat interval")
+	y += 8
+	for a := Action(0); a < actionCount; a++ {
+		mark := " "
+		if a == s.Selected {
+			mark = ">"
+		}
+		keys := play.Keymap.KeyNames(a)
+		if a == s.Selected && s.Capturing {
+			keys += " _"
+		}
+		b := play.Keymap[a]
+		repeat := "once"
+		if b.Delay > 0 {
+			repeat = fmt.Sprintf("after %d every %d", b.Delay, b.Interval)
+		}
+		line("%s %-12s %-20s %s", mark, a.Name(), repeat, keys)
+	}
+	if s.Status != "" {
+		y += 16
+		line("%s", s.Status)
+	}
+}
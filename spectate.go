@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+// focus is the player HUD shows, spectator cycles it with ACTION_FOCUS_NEXT
+func (play *Play) focus() int32 {
+	gs := play.GameSession
+	if !gs.Spectating() {
+		return gs.PlayerKey
+	}
+	if _, found := gs.Model.Players[play.Focus]; !found {
+		play.Focus = 0
+		if order := gs.PlayerOrder(); len(order) > 0 {
+			play.Focus = order[0]
+		}
+	}
+	return play.Focus
+}
+
+func (play *Play) cycleFocus(by int) {
+	order := play.GameSession.PlayerOrder()
+	if len(order) == 0 {
+		return
+	}
+	current := play.focus()
+	for i, key := range order {
+		if key == current {
+			play.Focus = order[(i+by+len(order))%len(order)]
+			return
+		}
+	}
+}
+
+// updateSpectator replaces movement keys, spectator only moves focus
+func (play *Play) updateSpectator() {
+	if !play.Keymap.Pressed(ACTION_FOCUS_NEXT) {
+		return
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		play.cycleFocus(-1)
+	} else {
+		play.cycleFocus(1)
+	}
+}
+
+// drawSpectator lists every player's inventory, focused one marked
+func (play *Play) drawSpectator(screen *ebiten.Image) {
+	focus := play.focus()
+	y := 20
+	for _, key := range play.GameSession.PlayerOrder() {
+		p := play.GameSession.Model.Players[key]
+		mark := " "
+		if key == focus {
+			mark = ">"
+		}
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%s%s keys %d diamonds %d", mark,
+			play.GameSession.Name(key), p.Keys, p.Diamonds),
+			screenWidth-150, y)
+		y += 14
+	}
+	ebitenutil.DebugPrintAt(screen, "spectating, tab to switch", screenWidth-150, y)
+}